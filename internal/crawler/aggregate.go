@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/bertinatto/testgrid/internal"
+)
+
+// Aggregated payload runs (/payload-aggregate) fan out into several runs of
+// the same job, named <job>-<n>, plus an aggregator job named aggregator-<job>
+// (or <job>-aggregator), which tells whether the job passed on the whole.
+var (
+	aggregatorJobRe = regexp.MustCompile(`^aggregator-(.+)$|^(.+)-aggregator$`)
+	aggregatedJobRe = regexp.MustCompile(`^(.+)-\d+$`)
+)
+
+// aggregatorBase returns the name of the job aggregated by the given job, if
+// it's an aggregator.
+func aggregatorBase(name string) (string, bool) {
+	m := aggregatorJobRe.FindStringSubmatch(name)
+	if m == nil {
+		return "", false
+	}
+	if m[1] != "" {
+		return m[1], true
+	}
+	return m[2], true
+}
+
+// recognizeAggregation fills in the name and aggregation of the job, given
+// the names of the jobs aggregated in the same payload run. Aggregated jobs
+// and their aggregator are named after the aggregated job, so they end up in
+// the same cell of the matrix.
+func recognizeAggregation(pj *internal.ProwJob, run string, aggregated map[string]bool) {
+	if base, ok := aggregatorBase(pj.Name); ok {
+		pj.Name = base
+		pj.AggregationID = run + "#" + base
+		pj.Aggregator = true
+		return
+	}
+	if m := aggregatedJobRe.FindStringSubmatch(pj.Name); m != nil && aggregated[m[1]] {
+		pj.Name = m[1]
+		pj.AggregationID = run + "#" + m[1]
+	}
+}
+
+// junitAggregatedFileRe matches the JUnit files written by the aggregator, e.g. junit-aggregated.xml.
+var junitAggregatedFileRe = regexp.MustCompile(`^junit-aggregated.*\.xml$`)
+
+// isAggregatedJUnit tells whether the artifact is the JUnit file with the
+// statistical verdict of each test, written by the aggregator.
+func isAggregatedJUnit(artifact string) bool {
+	return junitAggregatedFileRe.MatchString(path.Base(artifact))
+}
+
+// isTestJUnit tells whether the artifact is a JUnit file with test results worth summarizing.
+func isTestJUnit(artifact string) bool {
+	return isE2EJUnit(artifact) || isAggregatedJUnit(artifact)
+}
+
+// aggregate counts how the runs of each aggregated job went, and attaches
+// the counts to their aggregator along with its verdict.
+func (c *Crawler) aggregate() {
+	counts := map[string]*internal.Aggregation{}
+	c.data.update(
+		func(j *internal.ProwJob) bool { return j.AggregationID != "" && !j.Aggregator },
+		func(j *internal.ProwJob) {
+			a, ok := counts[j.AggregationID]
+			if !ok {
+				a = &internal.Aggregation{}
+				counts[j.AggregationID] = a
+			}
+			switch j.Result {
+			case "success":
+				a.Passed++
+			case "", internal.Pending:
+				a.Pending++
+			default:
+				a.Failed++
+			}
+		},
+	)
+
+	c.data.update(
+		func(j *internal.ProwJob) bool { return j.Aggregator },
+		func(j *internal.ProwJob) {
+			a, ok := counts[j.AggregationID]
+			if !ok {
+				a = &internal.Aggregation{}
+			}
+			switch j.Result {
+			case "success":
+				a.Verdict = "pass"
+			case internal.Pending:
+				a.Verdict = internal.Pending
+			case "":
+			default:
+				a.Verdict = "fail"
+			}
+			j.Aggregation = a
+		},
+	)
+}
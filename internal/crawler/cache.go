@@ -0,0 +1,308 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Default TTLs of the services whose pages change over time. Other hosts
+// serve job artifacts, which never change once the job is done, so they are
+// cached forever.
+const (
+	DefaultGitHubTTL       = 5 * time.Minute
+	DefaultPayloadTestsTTL = time.Hour
+)
+
+// DefaultCacheTTLs returns how long responses are cached for each host of the
+// given endpoints, so deployments other than OpenShift CI's expire as well.
+func DefaultCacheTTLs(e Endpoints) map[string]time.Duration {
+	ttls := map[string]time.Duration{}
+	set := func(base string, ttl time.Duration) {
+		u, err := url.Parse(base)
+		if err != nil || u.Host == "" {
+			return
+		}
+		// Hosts serving more than one service get the shortest TTL.
+		if current, ok := ttls[u.Host]; !ok || ttl < current {
+			ttls[u.Host] = ttl
+		}
+	}
+	set(e.GitHubAPI, DefaultGitHubTTL)
+	set(e.PayloadTests, DefaultPayloadTestsTTL)
+	return ttls
+}
+
+// Cache stores responses on disk. Only successful responses are stored, and
+// artifacts of jobs that are still running are never stored, since they are
+// bound to change. Each entry remembers when it was fetched, so it can expire
+// according to the TTL of its host.
+type Cache struct {
+	dir  string
+	ttls map[string]time.Duration
+}
+
+// cacheEntry is what is stored on disk for each URL.
+type cacheEntry struct {
+	Response  *Response
+	FetchedAt time.Time
+}
+
+// NewCache creates a cache in dir for the hosts of the given endpoints. The
+// given TTLs override the defaults; a zero TTL means the responses for that
+// host never expire.
+func NewCache(dir string, endpoints Endpoints, ttls map[string]time.Duration) *Cache {
+	merged := DefaultCacheTTLs(endpoints)
+	for host, ttl := range ttls {
+		merged[host] = ttl
+	}
+	return &Cache{dir: dir, ttls: merged}
+}
+
+// maxGitHubPageAge is how long the GitHub pages kept for conditional
+// requests are kept by Prune after they were last fetched in full. Pages that
+// are still in use are revalidated with GitHub anyway, so removing them only
+// costs a full request.
+const maxGitHubPageAge = 7 * 24 * time.Hour
+
+// Prune removes the expired and unreadable entries from the cache, as well as
+// the GitHub pages that haven't been fetched in full for maxGitHubPageAge,
+// and returns how many entries were removed.
+func (c *Cache) Prune() (int, error) {
+	removed := 0
+	err := c.walk(func(file string) error {
+		entry, err := readCacheEntry(file)
+		if err == nil && !c.expired(entry) {
+			return nil
+		}
+		removed++
+		return os.Remove(file)
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	pages, err := os.ReadDir(filepath.Join(c.dir, githubPagesDir))
+	if os.IsNotExist(err) {
+		return removed, nil
+	}
+	if err != nil {
+		return removed, err
+	}
+	for _, p := range pages {
+		file := filepath.Join(c.dir, githubPagesDir, p.Name())
+		page, err := readGitHubPage(file)
+		if p.IsDir() || err == nil && time.Since(page.Time) <= maxGitHubPageAge {
+			continue
+		}
+		removed++
+		if err := os.Remove(file); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Clear removes everything from the cache, including the GitHub pages.
+func (c *Cache) Clear() error {
+	entries, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(c.dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every response stored in the cache.
+func (c *Cache) walk(fn func(file string) error) error {
+	return filepath.WalkDir(c.dir, func(file string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == c.dir {
+				return nil
+			}
+			return err
+		}
+		// Entries live in directories named after the first two characters of their hash.
+		if d.IsDir() || len(filepath.Base(filepath.Dir(file))) != 2 {
+			return nil
+		}
+		return fn(file)
+	})
+}
+
+func (c *Cache) path(u string) string {
+	sum := sha1.Sum([]byte(u))
+	hash := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, hash[:2], hash)
+}
+
+func (c *Cache) ttl(u string) time.Duration {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return 0
+	}
+	return c.ttls[parsed.Host]
+}
+
+func (c *Cache) expired(e *cacheEntry) bool {
+	ttl := c.ttl(e.Response.URL)
+	return ttl > 0 && time.Since(e.FetchedAt) > ttl
+}
+
+func (c *Cache) get(u string) *cacheEntry {
+	entry, err := readCacheEntry(c.path(u))
+	if err != nil || c.expired(entry) {
+		return nil
+	}
+	return entry
+}
+
+func (c *Cache) put(resp *Response) error {
+	file := c.path(resp.URL)
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+"~")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(&cacheEntry{Response: resp, FetchedAt: time.Now()}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func readCacheEntry(file string) (*cacheEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entry := &cacheEntry{}
+	if err := gob.NewDecoder(f).Decode(entry); err != nil {
+		return nil, err
+	}
+	if entry.Response == nil {
+		return nil, errors.New("cache entry without a response")
+	}
+	return entry, nil
+}
+
+// cachingFetcher serves responses from a Cache, fetching and storing them when needed.
+type cachingFetcher struct {
+	fetcher Fetcher
+	cache   *Cache
+}
+
+func newCachingFetcher(f Fetcher, cache *Cache) Fetcher {
+	if cache == nil {
+		return f
+	}
+	return &cachingFetcher{fetcher: f, cache: cache}
+}
+
+func (f *cachingFetcher) Fetch(u string, header http.Header) (*Response, error) {
+	if entry := f.cache.get(u); entry != nil {
+		return entry.Response, nil
+	}
+
+	resp, err := f.fetcher.Fetch(u, header)
+	if err != nil || !resp.OK() || !isFinal(resp) {
+		return resp, err
+	}
+	if err := f.cache.put(resp); err != nil {
+		log.Printf("error caching %q: %v", u, err)
+	}
+	return resp, nil
+}
+
+// isFinal tells whether the response is about a job that has finished, so it
+// won't change anymore. Only prowjob.json, the prow job page and artifact
+// listings change while the job runs; other artifacts are only written once.
+func isFinal(resp *Response) bool {
+	parsed, err := url.Parse(resp.URL)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case path.Base(parsed.Path) == "prowjob.json":
+		var pj prowJobJSON
+		if err := json.Unmarshal(resp.Body, &pj); err != nil {
+			return false
+		}
+		switch pj.Status.State {
+		case "success", "failure", "aborted", "error":
+			return true
+		}
+		return false
+
+	case strings.HasPrefix(parsed.Path, "/view/"):
+		// This is a Spyglass page, which only lists the top-level
+		// finished.json among the artifacts once the job is done. Steps
+		// have their own finished.json files, but those are always nested.
+		return bytes.Contains(resp.Body, []byte(`"finished.json"`))
+
+	case isGCSListing(parsed):
+		// The listing of a job's artifacts only includes the top-level
+		// finished.json once the job is done. Should the listing take more
+		// than one page, the pages before that one are never cached.
+		var page gcsListing
+		if err := json.Unmarshal(resp.Body, &page); err != nil {
+			return false
+		}
+		finished := parsed.Query().Get("prefix") + "finished.json"
+		for _, item := range page.Items {
+			if item.Name == finished {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ParseCacheTTLs parses a comma-separated list of host=duration pairs, e.g.
+// "api.github.com=1m,pr-payload-tests.ci.openshift.org=30m".
+func ParseCacheTTLs(s string) (map[string]time.Duration, error) {
+	ttls := map[string]time.Duration{}
+	if s == "" {
+		return ttls, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		host, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid TTL %q, expected host=duration", pair)
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TTL for host %q: %w", host, err)
+		}
+		ttls[host] = ttl
+	}
+	return ttls, nil
+}
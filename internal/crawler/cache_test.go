@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIsFinal(t *testing.T) {
+	const logs = "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/job/101"
+	const listing = "https://storage.googleapis.com/storage/v1/b/test-platform-results/o?prefix=logs%2Fjob%2F101%2F"
+	for _, tc := range []struct {
+		name string
+		url  string
+		body string
+		want bool
+	}{
+		{"artifact", logs + "/finished.json", `{"result":"SUCCESS"}`, true},
+		{"finished prowjob.json", logs + "/prowjob.json", `{"status":{"state":"failure"}}`, true},
+		{"aborted prowjob.json", logs + "/prowjob.json", `{"status":{"state":"aborted"}}`, true},
+		{"running prowjob.json", logs + "/prowjob.json", `{"status":{"state":"pending"}}`, false},
+		{"invalid prowjob.json", logs + "/prowjob.json", `{`, false},
+		{"finished spyglass page", "https://prow.ci.openshift.org/view/gs/test-platform-results/logs/job/101", `var lensArtifacts = {"0":["finished.json"]};`, true},
+		{"running spyglass page", "https://prow.ci.openshift.org/view/gs/test-platform-results/logs/job/101", `var lensArtifacts = {"0":["artifacts/e2e/step/finished.json"]};`, false},
+		{"finished listing", listing, `{"items":[{"name":"logs/job/101/artifacts/e2e/step/finished.json"},{"name":"logs/job/101/finished.json"}]}`, true},
+		{"running listing", listing, `{"items":[{"name":"logs/job/101/artifacts/e2e/step/finished.json"}]}`, false},
+	} {
+		resp := &Response{URL: tc.url, StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(tc.body)}
+		if got := isFinal(resp); got != tc.want {
+			t.Errorf("%s: isFinal() = %v, expected %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDefaultCacheTTLs(t *testing.T) {
+	e := DefaultEndpoints
+	e.GitHubAPI = "https://github.example.com/api/v3"
+	e.PayloadTests = "https://payload-tests.example.com"
+	ttls := DefaultCacheTTLs(e)
+	if ttls["github.example.com"] != DefaultGitHubTTL || ttls["payload-tests.example.com"] != DefaultPayloadTestsTTL {
+		t.Errorf("expected the configured hosts to expire, got %v", ttls)
+	}
+	if _, ok := ttls["api.github.com"]; ok {
+		t.Errorf("expected no TTL for hosts that aren't configured, got %v", ttls)
+	}
+}
+
+func TestPruneGitHubPages(t *testing.T) {
+	dir := t.TempDir()
+	g := newGitHubClient(NewMemoryFetcher(), "https://api.github.com", "", dir)
+	g.store(&githubPage{URL: "https://api.github.com/repos/o/r/pulls/1", ETag: `"fresh"`, Time: time.Now()})
+	g.store(&githubPage{URL: "https://api.github.com/repos/o/r/pulls/2", ETag: `"stale"`, Time: time.Now().Add(-maxGitHubPageAge - time.Hour)})
+
+	removed, err := NewCache(dir, DefaultEndpoints, nil).Prune()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 page to be removed, got %d", removed)
+	}
+	if _, err := os.Stat(g.pagePath("https://api.github.com/repos/o/r/pulls/1")); err != nil {
+		t.Errorf("expected the fresh page to be kept: %v", err)
+	}
+	if _, err := os.Stat(g.pagePath("https://api.github.com/repos/o/r/pulls/2")); !os.IsNotExist(err) {
+		t.Errorf("expected the stale page to be removed, got %v", err)
+	}
+}
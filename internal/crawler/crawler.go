@@ -5,14 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/url"
-	"path"
+	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/bertinatto/testgrid/internal"
-	"github.com/gocolly/colly"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -20,199 +20,420 @@ type Crawler struct {
 	org           string
 	repo          string
 	pullRequestID int
-	data          map[string][]*internal.ProwJob
-	cacheDir      string
-	collector     *colly.Collector
-	ocpVersion    string
+	data          *jobStore
+	problems      *problemList
+	headSHA       string
+	endpoints     Endpoints
+	ocpVersions   []internal.Version
+	branchVers    map[string]internal.Version
+	fetcher       Fetcher
+	github        *githubClient
 }
 
-func New(org, repo string, prID int, ocpVersion string, cacheDir string) *Crawler {
-	allowedDomains := []string{
-		"github.com",
-		"api.github.com",
-		"pr-payload-tests.ci.openshift.org",
-		"gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com",
+// Options tweak how a Crawler fetches data.
+type Options struct {
+	// CacheDir is where scraped data is cached. Empty means no cache.
+	CacheDir string
+	// CacheTTLs overrides how long responses from each host are cached, see DefaultCacheTTLs.
+	CacheTTLs map[string]time.Duration
+	// GitHubToken is optional, but anonymous access is limited to 60 requests per hour.
+	GitHubToken string
+	// Fetcher retrieves pages and artifacts. Defaults to fetching from live hosts.
+	Fetcher Fetcher
+	// Parallelism is the maximum number of concurrent requests made to each host.
+	Parallelism int
+	// Delay is how long to wait after each request before making another one to the same host.
+	Delay time.Duration
+	// Endpoints tells where the CI services are. Defaults to DefaultEndpoints.
+	Endpoints *Endpoints
+	// Attempts is how many times a request is tried before giving up on
+	// transient failures, between 1 and MaxAttempts.
+	Attempts int
+	// BranchVersions tells the OCP version of PRs against development branches,
+	// when the version has to be inferred from the base branch of the PR.
+	BranchVersions map[string]internal.Version
+}
+
+// MaxAttempts is the most times a request may be tried.
+const MaxAttempts = 10
+
+// retryBackoff is the wait before the first retry; it doubles on every
+// attempt, up to maxRetryBackoff.
+const (
+	retryBackoff    = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// New creates a Crawler for the given pull request, which looks for the jobs
+// of the given OCP versions. If no version is given, it is inferred from the
+// base branch of the pull request.
+func New(pr internal.PullRequest, ocpVersions []internal.Version, opts Options) *Crawler {
+	endpoints := DefaultEndpoints
+	if opts.Endpoints != nil {
+		endpoints = *opts.Endpoints
+	}
+	fetcher := opts.Fetcher
+	if fetcher == nil {
+		fetcher = NewHTTPFetcher(nil)
+	}
+	fetcher = newRewritingFetcher(fetcher, endpoints)
+	fetcher = newLimitedFetcher(fetcher, opts.Parallelism, opts.Delay)
+	var cache *Cache
+	if opts.CacheDir != "" {
+		cache = NewCache(opts.CacheDir, endpoints, opts.CacheTTLs)
 	}
 	return &Crawler{
-		org:           org,
-		repo:          repo,
-		pullRequestID: prID,
-		ocpVersion:    ocpVersion,
-		data:          make(map[string][]*internal.ProwJob, 128),
-		cacheDir:      cacheDir,
-		collector:     newCollector(cacheDir, allowedDomains...),
+		org:           pr.Org,
+		repo:          pr.Repo,
+		pullRequestID: pr.Number,
+		ocpVersions:   ocpVersions,
+		branchVers:    opts.BranchVersions,
+		data:          newJobStore(),
+		problems:      &problemList{},
+		fetcher:       newCachingFetcher(newRetryingFetcher(fetcher, opts.Attempts, retryBackoff, maxRetryBackoff), cache),
+		github:        newGitHubClient(newCachingFetcher(fetcher, cache), endpoints.GitHubAPI, opts.GitHubToken, opts.CacheDir),
+		endpoints:     endpoints,
 	}
 }
 
-func (c *Crawler) Do() map[string][]*internal.ProwJob {
-	urls := c.parsePR()
+// Do crawls the pull request and returns the prow jobs found, indexed by job
+// name. An error is only returned if the crawl couldn't be done at all;
+// problems with individual pages are available through Problems.
+func (c *Crawler) Do() (map[string][]*internal.ProwJob, error) {
+	pr, err := c.github.pullRequest(c.org, c.repo, c.pullRequestID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pull request: %w", err)
+	}
+	c.headSHA = pr.Head.SHA
+	if len(c.ocpVersions) == 0 {
+		v, ok := internal.VersionForBranch(pr.Base.Ref, c.branchVers)
+		if !ok {
+			return nil, fmt.Errorf("cannot infer the OCP version from base branch %q", pr.Base.Ref)
+		}
+		log.Printf("Inferred OCP version %s from base branch %q", v, pr.Base.Ref)
+		c.ocpVersions = []internal.Version{v}
+	}
+
+	urls, err := c.parsePR()
+	if err != nil {
+		return nil, fmt.Errorf("error reading pull request comments: %w", err)
+	}
 	prowJobsURLs, finishedURLs := c.parsePayloadJobs(urls)
-	installURLs := c.parseProwJobsURLs(prowJobsURLs)
-	c.parseInstallTXT(installURLs)
-	c.parseFinishedJSON(finishedURLs)
-	return c.data
+	c.crawlJobs(prowJobsURLs, finishedURLs)
+	return c.data.snapshot(), nil
 }
 
-func (c *Crawler) parsePR() []string {
-	payloadJobs := sets.NewString()
-	collector := newCollector(c.cacheDir, "github.com", "api.github.com")
+// Refresh crawls again the jobs that were pending, leaving the others alone.
+// It must only be called after Do.
+func (c *Crawler) Refresh() map[string][]*internal.ProwJob {
+	prowJobsURLs := []string{}
+	finishedURLs := []string{}
+	c.data.update(
+		func(j *internal.ProwJob) bool { return j.Result == internal.Pending },
+		func(j *internal.ProwJob) {
+			prowJobsURLs = append(prowJobsURLs, j.URL)
+			finishedURLs = append(finishedURLs, j.ResultURL)
+
+			// Forget what we know about the job, it's about to be replaced.
+			j.Result, j.State = "", ""
+			j.ResultFetchError, j.InstallStatusFetchError = "", ""
+			j.JUnitURLs, j.Tests = nil, nil
+			j.InstallLogURLs, j.InstallFailure = nil, nil
+			if j.InstallStatus == internal.Pending {
+				j.InstallStatus = ""
+			}
+		},
+	)
+	refreshed := sets.NewString(prowJobsURLs...)
+	c.problems.forget(func(u string) bool {
+		for _, j := range refreshed.List() {
+			if u == j {
+				return true
+			}
+			if base, err := c.endpoints.artifactURL(j, ""); err == nil && strings.HasPrefix(u, base+"/") {
+				return true
+			}
+			if bucket, prefix, ok := c.endpoints.gcsLocation(j); ok && strings.HasPrefix(u, c.endpoints.gcsListURL(bucket, prefix+"/", "")) {
+				return true
+			}
+		}
+		return false
+	})
+
+	c.crawlJobs(prowJobsURLs, finishedURLs)
+	return c.data.snapshot()
+}
+
+// Pending returns the number of jobs that haven't finished yet.
+func (c *Crawler) Pending() int {
+	n := 0
+	c.data.update(
+		func(j *internal.ProwJob) bool { return j.Result == internal.Pending },
+		func(*internal.ProwJob) { n++ },
+	)
+	return n
+}
 
-	// Create a callback that will be called once we visit the PR page.
-	collector.OnResponse(func(r *colly.Response) {
-		var comments []struct {
-			URL  string `string:"url"`
-			Body string `string:"body"`
+// crawlJobs fetches everything we want to know about the given prow jobs.
+func (c *Crawler) crawlJobs(prowJobsURLs, finishedURLs []string) {
+	spyglass, gcs := c.splitByStorage(prowJobsURLs)
+	installs, junitURLs := c.parseProwJobsURLs(spyglass)
+	gcsInstalls, gcsJUnitURLs, unfinished := c.listGCSArtifacts(gcs)
+	installs = append(installs, gcsInstalls...)
+	junitURLs = append(junitURLs, gcsJUnitURLs...)
+
+	// There's no point in fetching the results we know aren't there yet.
+	resultURLs := []string{}
+	for _, u := range finishedURLs {
+		if !unfinished.Has(u) {
+			resultURLs = append(resultURLs, u)
 		}
+	}
 
-		if err := json.Unmarshal(r.Body, &comments); err != nil {
-			log.Printf("error unmarshalling %q: %v", r.Request.URL.String(), err)
-			return
+	c.parseInstallStatus(installs)
+	c.classifyInstallFailures()
+	c.parseFinishedJSON(resultURLs)
+	c.parseJUnit(junitURLs)
+	c.parseStartedJSON(c.artifactURLs(prowJobsURLs, "started.json"))
+	c.parseProwJobJSON(c.artifactURLs(prowJobsURLs, "prowjob.json"))
+	c.markPending()
+	c.markOutdated()
+	c.aggregate()
+}
+
+// PullRequest returns the pull request being crawled.
+func (c *Crawler) PullRequest() internal.PullRequest {
+	return internal.PullRequest{Org: c.org, Repo: c.repo, Number: c.pullRequestID}
+}
+
+// Versions returns the OCP versions whose jobs are crawled. If they are
+// inferred from the base branch, they are only known after the crawl is done.
+func (c *Crawler) Versions() []internal.Version {
+	return c.ocpVersions
+}
+
+// HeadSHA returns the commit the pull request currently points to. It is only
+// known after the crawl is done.
+func (c *Crawler) HeadSHA() string {
+	return c.headSHA
+}
+
+// markOutdated flags the jobs that tested a commit other than the current
+// head of the pull request, e.g. because the PR was force-pushed since.
+// Jobs for which the commit is unknown are given the benefit of the doubt.
+func (c *Crawler) markOutdated() {
+	if c.headSHA == "" {
+		return
+	}
+	c.data.update(
+		func(j *internal.ProwJob) bool { return j.PRHeadSHA != "" },
+		func(j *internal.ProwJob) { j.Outdated = !internal.SameCommit(j.PRHeadSHA, c.headSHA) },
+	)
+}
+
+// Problems returns the issues found while crawling individual pages.
+func (c *Crawler) Problems() []internal.CrawlProblem {
+	return c.problems.list()
+}
+
+func (c *Crawler) parsePR() ([]string, error) {
+	payloadJobs := sets.NewString()
+	pages, comments := 0, 0
+	re := regexp.MustCompile(regexp.QuoteMeta(c.endpoints.PayloadTests) + `/runs/ci/.+`)
+
+	// Visit the PR page (through the API). GitHub returns at most 100 comments
+	// per page, so keep following the "next" link until we have seen all of them.
+	next := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments?per_page=100", c.endpoints.GitHubAPI, c.org, c.repo, c.pullRequestID)
+	for next != "" {
+		page, err := c.github.get(next)
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []struct {
+			URL  string `json:"url"`
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal(page.Body, &batch); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %q: %w", page.URL, err)
 		}
+		pages++
+		comments += len(batch)
 
 		// Create a list of all links to payload runs available in the PR page.
 		urls := []string{}
-		re := regexp.MustCompile(`https://pr-payload-tests\.ci\.openshift\.org/runs/ci/.+`)
-		for _, c := range comments {
+		for _, c := range batch {
 			urls = append(urls, re.FindAllString(c.Body, -1)...)
 		}
 
 		// Filter out and deduplicate urls found.
 		for _, url := range urls {
-			if strings.HasPrefix(url, "https://pr-payload-tests.ci.openshift.org") {
+			if strings.HasPrefix(url, c.endpoints.PayloadTests) {
 				payloadJobs.Insert(url)
 			}
 		}
-	})
 
-	// Finally, visit the PR page (through the API).
-	// TODO: add pagination, otherwise it won't be possible to scrape more than 100 jobs.
-	collector.Visit(fmt.Sprintf("https://api.github.com/repos/%s/%s/issues/%d/comments?per_page=100", c.org, c.repo, c.pullRequestID))
+		next = nextPageURL(page.Link)
+	}
+	log.Printf("Scanned %d comments in %d pages, found %d payload runs", comments, pages, payloadJobs.Len())
+
+	return payloadJobs.List(), nil
+}
+
+// jobVersion returns the version the job is for, if it's one of the given
+// versions. Jobs of other versions may run in the same payload run, e.g. the
+// 4.15 job ci-4.15-upgrade-from-stable-4.14, which is not a 4.14 job.
+func jobVersion(name string, versions []internal.Version) (string, bool) {
+	v, ok := internal.JobVersion(name)
+	if !ok {
+		return "", false
+	}
+	for _, want := range versions {
+		if v == want {
+			return v.String(), true
+		}
+	}
+	return "", false
+}
 
-	return payloadJobs.List()
+// nextPageURL returns the URL tagged with rel="next" in a GitHub Link header, if any.
+// The header looks like: <https://api.github.com/...&page=2>; rel="next", <...>; rel="last"
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(strings.TrimSpace(part), ";")
+		if len(segments) < 2 {
+			continue
+		}
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(target, "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// payloadJob is a job listed in a payload run page.
+type payloadJob struct {
+	name    string
+	href    string
+	version string
 }
 
 func (c *Crawler) parsePayloadJobs(urls []string) ([]string, []string) {
+	var mu sync.Mutex
 	prowJobsURLs := []string{}
 	finishedURLs := []string{}
-	collector := newCollector(c.cacheDir, "pr-payload-tests.ci.openshift.org")
 
-	// Create a callback that will be called once we visit payload job page.
-	collector.OnHTML("li", func(e *colly.HTMLElement) {
-		e.ForEach("tt", func(_ int, el *colly.HTMLElement) {
-			jobName := el.ChildText("span")
-			href := el.ChildAttr("a", "href")
+	// Visit all payload job pages provided to this function.
+	c.visit(urls, nil, func(r *Response) {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+		if err != nil {
+			c.problems.add(r.URL, "error parsing payload run page: %v", err)
+			return
+		}
+
+		jobs := []payloadJob{}
+		aggregated := map[string]bool{}
+		doc.Find("li tt").Each(func(_ int, el *goquery.Selection) {
+			jobName := strings.TrimSpace(el.Find("span").Text())
+			href, _ := el.Find("a").Attr("href")
 
-			// We are only interested in the current OCP version.
-			if !strings.Contains(jobName, c.ocpVersion) {
+			// We are only interested in the OCP versions we were asked for.
+			version, ok := jobVersion(jobName, c.ocpVersions)
+			if !ok {
 				return
 			}
+			if base, ok := aggregatorBase(jobName); ok {
+				aggregated[base] = true
+			}
+			jobs = append(jobs, payloadJob{name: jobName, href: href, version: version})
+		})
 
+		for _, job := range jobs {
 			// Construct the URL for the finished.json file.
-			base := strings.ReplaceAll(
-				href,
-				"https://prow.ci.openshift.org/view/gs/",
-				"https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/",
-			)
-			finished, err := url.Parse(base)
+			finished, err := c.endpoints.artifactURL(job.href, "finished.json")
 			if err != nil {
-				log.Fatalf("error parsing %q: %v", base, err)
+				c.problems.add(r.URL, "error parsing link to job %q: %v", job.name, err)
+				continue
 			}
-			finished.Path = path.Join(finished.Path, "finished.json")
 
 			// Store what we have found so  far. We'll fetch and parse the finished.json file later on.
-			c.data[jobName] = append(c.data[jobName], &internal.ProwJob{
-				Name:      jobName,
-				URL:       href,
-				ResultURL: finished.String(),
-			})
-
-			prowJobsURLs = append(prowJobsURLs, href)
-			finishedURLs = append(finishedURLs, finished.String())
-		})
-	})
+			pj := &internal.ProwJob{
+				Name:      job.name,
+				URL:       job.href,
+				ResultURL: finished,
+				BuildID:   buildID(job.href),
+				Version:   job.version,
+			}
+			recognizeAggregation(pj, r.URL, aggregated)
+			c.data.add(pj)
 
-	// Finally, visit all urls provided to this function.
-	for _, url := range urls {
-		collector.Visit(url)
-	}
+			mu.Lock()
+			prowJobsURLs = append(prowJobsURLs, job.href)
+			finishedURLs = append(finishedURLs, finished)
+			mu.Unlock()
+		}
+	})
 
 	return prowJobsURLs, finishedURLs
 }
 
 func (c *Crawler) parseFinishedJSON(urls []string) {
-	collector := newCollector(c.cacheDir, "gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com")
-
-	// Before visiting prow job pages, create a callback that will be called for every visited page.
-	collector.OnResponse(func(r *colly.Response) {
-		jobResult := map[string]any{}
+	// Visit all finished.json files provided to this function.
+	failed := func(u string, err error) {
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.ResultURL == u },
+			func(j *internal.ProwJob) { j.ResultFetchError = err.Error() },
+		)
+	}
+	c.visit(urls, failed, func(r *Response) {
+		var jobResult struct {
+			Timestamp int64  `json:"timestamp"`
+			Result    string `json:"result"`
+		}
 		if err := json.Unmarshal(r.Body, &jobResult); err != nil {
-			log.Printf("error unmarshalling %q: %v", r.Request.URL.String(), err)
+			c.problems.add(r.URL, "error unmarshalling finished.json: %v", err)
 			return
 		}
-
-		result := strings.ToLower(jobResult["result"].(string))
-
-		// Store the result to our global store.
-		for _, values := range c.data {
-			for _, j := range values {
-				if j.ResultURL == r.Request.URL.String() {
-					j.Result = result
-				}
-			}
-		}
-	})
-
-	// Finally, Visit all prow job urls provided to this function.
-	for _, url := range urls {
-		collector.Visit(url)
-	}
-}
-
-func (c *Crawler) parseInstallTXT(urls []string) {
-	collector := newCollector(c.cacheDir, "gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com")
-
-	// Before visiting prow job pages, create a callback that will be called for every visited page.
-	collector.OnResponse(func(r *colly.Response) {
-		status := string(bytes.TrimSpace(r.Body))
-		_, err := strconv.Atoi(status)
-		if err != nil {
-			// This means the status is invalid, so leave it empty
+		if jobResult.Result == "" {
+			c.problems.add(r.URL, "finished.json does not contain a result")
 			return
 		}
 
-		// Assume the installation succeeded if the install-status.txt
-		// file contains "0" otherwise assume that the it failed.
-		switch status {
-		case "":
-			break
-		case "0":
-			status = "success"
-		default:
-			status = "failure"
-		}
+		result := strings.ToLower(jobResult.Result)
 
-		// Store the installation status to our global store.
-		for _, values := range c.data {
-			for _, j := range values {
-				if j.InstallStatusURL == r.Request.URL.String() {
-					j.InstallStatus = string(status)
+		// Store the result to our global store.
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.ResultURL == r.URL },
+			func(j *internal.ProwJob) {
+				j.Result = result
+				if jobResult.Timestamp != 0 {
+					j.FinishTime = time.Unix(jobResult.Timestamp, 0)
 				}
-			}
-		}
+			},
+		)
 	})
-
-	// Finally, Visit all prow job urls provided to this function.
-	for _, url := range urls {
-		collector.Visit(url)
-	}
 }
 
-func (c *Crawler) parseProwJobsURLs(urls []string) []string {
-	installURLs := []string{}
-	collector := newCollector(c.cacheDir, "prow.ci.openshift.org")
-
-	// Before visiting prow job pages, create a callback that will be called for every visited page.
-	collector.OnResponse(func(r *colly.Response) {
+func (c *Crawler) parseProwJobsURLs(urls []string) ([][]installCandidate, []string) {
+	var mu sync.Mutex
+	installs := [][]installCandidate{}
+	junitURLs := []string{}
+
+	// Visit all prow job pages provided to this function. If we can't get
+	// to the page, we can't tell where the install status is either.
+	failed := func(u string, err error) {
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.URL == u },
+			func(j *internal.ProwJob) { j.InstallStatusFetchError = err.Error() },
+		)
+	}
+	c.visit(urls, failed, func(r *Response) {
 		lensArtifacts := map[string][]string{}
 		re := regexp.MustCompile(`var lensArtifacts = (.+?);`)
 		matches := re.FindSubmatch(r.Body)
@@ -220,61 +441,147 @@ func (c *Crawler) parseProwJobsURLs(urls []string) []string {
 			jsonStr := matches[1]
 			err := json.Unmarshal([]byte(jsonStr), &lensArtifacts)
 			if err != nil {
-				log.Printf("error unmarshalling: %v", err)
+				c.problems.add(r.URL, "error unmarshalling lens artifacts: %v", err)
 				return
 			}
 		}
 
-		statusPath := ""
+		// Spyglass doesn't list install-status.txt, but gather-must-gather
+		// writes it next to its finished.json, which is listed. It may be
+		// missing though, so the other candidates are kept as fallbacks.
+		artifacts := []string{}
 		for _, v := range lensArtifacts["0"] {
+			artifacts = append(artifacts, v)
 			if strings.HasSuffix(v, "gather-must-gather/finished.json") {
-				statusPath = strings.ReplaceAll(v, "finished.json", "artifacts/install-status.txt")
+				artifacts = append(artifacts, strings.ReplaceAll(v, "finished.json", "artifacts/install-status.txt"))
+			}
+		}
+		for k, v := range lensArtifacts {
+			if k != "0" {
+				artifacts = append(artifacts, v...)
 			}
 		}
 
-		if statusPath != "" {
-			// Construct the URL for the install-status.txt file.
-			base := strings.ReplaceAll(
-				r.Request.URL.String(),
-				"https://prow.ci.openshift.org/view/gs/",
-				"https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/",
+		// Construct the URLs for the files that may tell the install status.
+		candidates := []installCandidate{}
+		for _, statusPath := range rankInstallStatus(artifacts) {
+			install, err := c.endpoints.artifactURL(r.URL, statusPath)
+			if err != nil {
+				c.problems.add(r.URL, "error parsing job URL: %v", err)
+				return
+			}
+			candidates = append(candidates, installCandidate{url: install, source: installSource(statusPath)})
+		}
+		if len(candidates) > 0 {
+			mu.Lock()
+			installs = append(installs, candidates)
+			mu.Unlock()
+
+			// Store the best install status URL to our global store.
+			c.data.update(
+				func(j *internal.ProwJob) bool { return j.URL == r.URL },
+				func(j *internal.ProwJob) {
+					j.InstallStatusURL = candidates[0].url
+					j.InstallSource = candidates[0].source
+				},
 			)
-			install, err := url.Parse(base)
+		}
+
+		// Collect the logs that may explain an install failure.
+		logs := []string{}
+		for _, p := range sets.NewString(artifacts...).List() {
+			if !isInstallLog(p) {
+				continue
+			}
+			l, err := c.endpoints.artifactURL(r.URL, p)
 			if err != nil {
-				log.Fatalf("error parsing %q: %v", base, err)
+				c.problems.add(r.URL, "error parsing job URL: %v", err)
+				return
 			}
-			install.Path = path.Join(install.Path, statusPath)
-			installURLs = append(installURLs, install.String())
-
-			// Store the install status URL to our global store.
-			for _, values := range c.data {
-				for _, j := range values {
-					if j.URL == r.Request.URL.String() {
-						j.InstallStatusURL = install.String()
-					}
+			logs = append(logs, l)
+		}
+		if len(logs) > 0 {
+			c.data.update(
+				func(j *internal.ProwJob) bool { return j.URL == r.URL },
+				func(j *internal.ProwJob) { j.InstallLogURLs = logs },
+			)
+		}
+
+		// Collect the JUnit files written by the e2e tests, the same file
+		// may be listed by more than one lens.
+		junitPaths := sets.NewString()
+		for _, artifacts := range lensArtifacts {
+			for _, v := range artifacts {
+				if isTestJUnit(v) {
+					junitPaths.Insert(v)
 				}
 			}
 		}
-	})
+		if junitPaths.Len() == 0 {
+			return
+		}
 
-	// Finally, Visit all prow job urls provided to this function.
-	for _, url := range urls {
-		collector.Visit(url)
-	}
+		found := []string{}
+		for _, p := range junitPaths.List() {
+			junit, err := c.endpoints.artifactURL(r.URL, p)
+			if err != nil {
+				c.problems.add(r.URL, "error parsing job URL: %v", err)
+				return
+			}
+			found = append(found, junit)
+		}
+		mu.Lock()
+		junitURLs = append(junitURLs, found...)
+		mu.Unlock()
+
+		// Store the JUnit URLs to our global store.
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.URL == r.URL },
+			func(j *internal.ProwJob) { j.JUnitURLs = found },
+		)
+	})
 
-	return installURLs
+	return installs, junitURLs
 }
 
-func newCollector(cacheDir string, allowed ...string) *colly.Collector {
-	c := colly.NewCollector(
-		colly.AllowedDomains(allowed...),
-		colly.CacheDir(cacheDir),
-	)
-
-	// Create a callback that will run before every request made.
-	c.OnRequest(func(r *colly.Request) {
-		log.Println("Visiting", r.URL.String())
-	})
+// artifactURLs returns the URLs of the given artifact for each of the jobs.
+func (c *Crawler) artifactURLs(jobURLs []string, artifact string) []string {
+	urls := make([]string, 0, len(jobURLs))
+	for _, j := range jobURLs {
+		if u, err := c.endpoints.artifactURL(j, artifact); err == nil {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
 
-	return c
+// visit fetches every url concurrently and calls fn with each successful
+// response. The number of requests in flight to each host is bounded by the
+// fetcher, but fn may be called from several goroutines at once. If a url
+// can't be fetched, the problem is recorded and failed is called with the
+// reason, unless the url simply doesn't exist.
+func (c *Crawler) visit(urls []string, failed func(u string, err error), fn func(r *Response)) {
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			r, err := c.fetcher.Fetch(u, nil)
+			if err == nil && !r.OK() {
+				err = fmt.Errorf("%s", r.Status())
+			}
+			if err != nil {
+				log.Printf("error visiting %q: %v", u, err)
+				if r == nil || r.StatusCode != http.StatusNotFound {
+					c.problems.add(u, "error fetching: %v", err)
+					if failed != nil {
+						failed(u, err)
+					}
+				}
+				return
+			}
+			fn(r)
+		}(u)
+	}
+	wg.Wait()
 }
@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bertinatto/testgrid/internal"
+)
+
+const (
+	testJobURL = "https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-release-master-ci-4.15-e2e-aws-ovn/101"
+	testJobDir = "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/test-platform-results/logs/periodic-ci-openshift-release-master-ci-4.15-e2e-aws-ovn/101"
+)
+
+// newTestFetcher serves a pull request with a single payload run, which ran
+// a 4.15 job and a 4.16 job.
+func newTestFetcher() *MemoryFetcher {
+	f := NewMemoryFetcher()
+	f.Add("https://api.github.com/repos/o/r/pulls/1", http.StatusOK, []byte(`{"head":{"sha":"abc123"},"base":{"ref":"release-4.15"}}`))
+	f.Add("https://api.github.com/repos/o/r/issues/1/comments?per_page=100", http.StatusOK, []byte(`[
+		{"url":"x","body":"see https://pr-payload-tests.ci.openshift.org/runs/ci/run-1"},
+		{"url":"y","body":"no payload runs here"}
+	]`))
+	f.Add("https://pr-payload-tests.ci.openshift.org/runs/ci/run-1", http.StatusOK, []byte(fmt.Sprintf(`<html><ul>
+		<li><tt><span>periodic-ci-openshift-release-master-ci-4.15-e2e-aws-ovn</span> <a href=%q>link</a></tt></li>
+		<li><tt><span>periodic-ci-openshift-release-master-ci-4.16-e2e-aws-ovn</span> <a href="https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-release-master-ci-4.16-e2e-aws-ovn/102">link</a></tt></li>
+	</ul></html>`, testJobURL)))
+	f.Add(testJobURL, http.StatusOK, []byte(`<script>var lensArtifacts = {"0":["artifacts/e2e-aws-ovn/gather-must-gather/finished.json"],"3":["artifacts/e2e-aws-ovn/openshift-e2e-test/artifacts/junit/junit_e2e.xml"]};</script>`))
+	f.Add(testJobDir+"/finished.json", http.StatusOK, []byte(`{"timestamp":1700003600,"passed":false,"result":"FAILURE"}`))
+	f.Add(testJobDir+"/artifacts/e2e-aws-ovn/gather-must-gather/artifacts/install-status.txt", http.StatusOK, []byte("0\n"))
+	f.Add(testJobDir+"/artifacts/e2e-aws-ovn/openshift-e2e-test/artifacts/junit/junit_e2e.xml", http.StatusOK, []byte(`<testsuite><testcase name="a"/><testcase name="b"><failure message="boom"/></testcase></testsuite>`))
+	return f
+}
+
+func TestCrawl(t *testing.T) {
+	c := New(internal.PullRequest{Org: "o", Repo: "r", Number: 1}, nil, Options{Fetcher: newTestFetcher()})
+	jobs, err := c.Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := c.HeadSHA(); got != "abc123" {
+		t.Errorf("expected head commit abc123, got %q", got)
+	}
+	if v := c.Versions(); len(v) != 1 || v[0].String() != "4.15" {
+		t.Errorf("expected version 4.15 to be inferred from the base branch, got %v", v)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected only the 4.15 job, got %d jobs: %v", len(jobs), jobs)
+	}
+	runs := jobs["periodic-ci-openshift-release-master-ci-4.15-e2e-aws-ovn"]
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run of the 4.15 job, got %d", len(runs))
+	}
+
+	pj := runs[0]
+	if pj.URL != testJobURL || pj.BuildID != "101" || pj.Version != "4.15" {
+		t.Errorf("unexpected job: URL %q, build %q, version %q", pj.URL, pj.BuildID, pj.Version)
+	}
+	if pj.Result != "failure" {
+		t.Errorf("expected result failure, got %q", pj.Result)
+	}
+	if pj.InstallStatus != "success" {
+		t.Errorf("expected install status success, got %q", pj.InstallStatus)
+	}
+	if pj.Tests == nil || pj.Tests.Passed != 1 || pj.Tests.Failed != 1 {
+		t.Errorf("expected 1 passed and 1 failed test, got %+v", pj.Tests)
+	}
+	if problems := c.Problems(); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestCrawlMissingInstallStatus(t *testing.T) {
+	f := newTestFetcher()
+	// install-status.txt is only guessed on the Spyglass path, so the listed
+	// junit_install.xml must be used when it doesn't exist.
+	f.Add(testJobDir+"/artifacts/e2e-aws-ovn/gather-must-gather/artifacts/install-status.txt", http.StatusNotFound, nil)
+	f.Add(testJobURL, http.StatusOK, []byte(`<script>var lensArtifacts = {"0":["artifacts/e2e-aws-ovn/gather-must-gather/finished.json","artifacts/e2e-aws-ovn/ipi-install-install/artifacts/junit_install.xml"]};</script>`))
+	f.Add(testJobDir+"/artifacts/e2e-aws-ovn/ipi-install-install/artifacts/junit_install.xml", http.StatusOK, []byte(`<testsuite><testcase name="install should succeed: infrastructure"><failure message="terraform failed"/></testcase></testsuite>`))
+
+	c := New(internal.PullRequest{Org: "o", Repo: "r", Number: 1}, nil, Options{Fetcher: f})
+	jobs, err := c.Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pj := jobs["periodic-ci-openshift-release-master-ci-4.15-e2e-aws-ovn"][0]
+	if pj.InstallStatus != "failure" || pj.InstallSource != "ipi-install-install/artifacts/junit_install.xml" {
+		t.Errorf("expected a failed install from junit_install.xml, got %q from %q", pj.InstallStatus, pj.InstallSource)
+	}
+	if pj.InstallFailure == nil || pj.InstallFailure.Phase != internal.PhaseInfrastructure {
+		t.Errorf("expected the install to fail provisioning infrastructure, got %+v", pj.InstallFailure)
+	}
+}
+
+func TestCrawlUpgradeFromPreviousVersion(t *testing.T) {
+	f := newTestFetcher()
+	f.Add("https://pr-payload-tests.ci.openshift.org/runs/ci/run-1", http.StatusOK, []byte(`<html><ul>
+		<li><tt><span>periodic-ci-openshift-release-master-ci-4.15-upgrade-from-stable-4.14-e2e-aws-ovn-upgrade</span> <a href="https://prow.ci.openshift.org/view/gs/test-platform-results/logs/periodic-ci-openshift-release-master-ci-4.15-upgrade-from-stable-4.14-e2e-aws-ovn-upgrade/103">link</a></tt></li>
+	</ul></html>`))
+
+	for _, tc := range []struct {
+		version string
+		want    int
+	}{
+		{"4.14", 0},
+		{"4.15", 1},
+	} {
+		v, _ := internal.ParseVersion(tc.version)
+		c := New(internal.PullRequest{Org: "o", Repo: "r", Number: 1}, []internal.Version{v}, Options{Fetcher: f})
+		jobs, err := c.Do()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(jobs) != tc.want {
+			t.Errorf("%s: expected %d jobs, got %d: %v", tc.version, tc.want, len(jobs), jobs)
+		}
+	}
+}
+
+func TestCrawlCommentPages(t *testing.T) {
+	f := newTestFetcher()
+	// The payload run is only mentioned in the second page of comments.
+	f.AddResponse(&Response{
+		URL:        "https://api.github.com/repos/o/r/issues/1/comments?per_page=100",
+		StatusCode: http.StatusOK,
+		Header: http.Header{"Link": []string{
+			`<https://api.github.com/repos/o/r/issues/1/comments?per_page=100&page=2>; rel="next", <https://api.github.com/repos/o/r/issues/1/comments?per_page=100&page=2>; rel="last"`,
+		}},
+		Body: []byte(`[{"url":"x","body":"no payload runs here"}]`),
+	})
+	f.Add("https://api.github.com/repos/o/r/issues/1/comments?per_page=100&page=2", http.StatusOK, []byte(`[{"url":"y","body":"see https://pr-payload-tests.ci.openshift.org/runs/ci/run-1"}]`))
+
+	c := New(internal.PullRequest{Org: "o", Repo: "r", Number: 1}, nil, Options{Fetcher: f})
+	jobs, err := c.Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("expected the job of the payload run in the second page, got %d jobs", len(jobs))
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	for _, tc := range []struct {
+		link string
+		want string
+	}{
+		{"", ""},
+		{`<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=2"},
+		{`<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=3>; rel="next"`, "https://api.github.com/x?page=3"},
+		{`<https://api.github.com/x?page=1>; rel="first", <https://api.github.com/x?page=1>; rel="prev"`, ""},
+		{`https://api.github.com/x?page=2; rel="next"`, ""},
+	} {
+		if got := nextPageURL(tc.link); got != tc.want {
+			t.Errorf("nextPageURL(%q) = %q, expected %q", tc.link, got, tc.want)
+		}
+	}
+}
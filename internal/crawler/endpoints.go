@@ -0,0 +1,179 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Endpoints tells the crawler where to find the CI services it scrapes.
+type Endpoints struct {
+	// GitHubAPI is the base URL of the GitHub REST API.
+	GitHubAPI string `json:"github_api,omitempty"`
+	// PayloadTests is the base URL of the service that runs payload tests on PRs.
+	PayloadTests string `json:"payload_tests,omitempty"`
+	// Artifacts maps the prefix of prow job URLs (i.e. Spyglass views) to the
+	// prefix of the URLs from which the artifacts of the job can be downloaded.
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+	// GCS is the base URL of the Google Cloud Storage API.
+	GCS string `json:"gcs,omitempty"`
+	// GCSBuckets lists the buckets whose artifacts are listed and read
+	// through the GCS API, rather than found by scraping the Spyglass page
+	// of the job and downloaded from the Artifacts mappings.
+	GCSBuckets []string `json:"gcs_buckets,omitempty"`
+	// Rewrites maps URL prefixes to the prefixes they are actually fetched
+	// from. URLs are rewritten right before fetching, so the report still
+	// links to the original locations. Useful to point at a stand-in server.
+	Rewrites map[string]string `json:"rewrites,omitempty"`
+}
+
+// DefaultEndpoints are the endpoints of the OpenShift CI.
+var DefaultEndpoints = Endpoints{
+	GitHubAPI:    "https://api.github.com",
+	PayloadTests: "https://pr-payload-tests.ci.openshift.org",
+	Artifacts: map[string]string{
+		"https://prow.ci.openshift.org/view/gs/": "https://gcsweb-ci.apps.ci.l2s4.p1.openshiftapps.com/gcs/",
+	},
+	GCS: "https://storage.googleapis.com",
+}
+
+// LoadEndpoints reads endpoints from a JSON file. Fields missing from the
+// file are taken from DefaultEndpoints; artifact mappings, GCS buckets and
+// rewrites are added to the default ones.
+func LoadEndpoints(file string) (Endpoints, error) {
+	e := DefaultEndpoints.clone()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return e, err
+	}
+	var loaded Endpoints
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return e, fmt.Errorf("error unmarshalling %q: %w", file, err)
+	}
+	e.merge(loaded)
+	return e, nil
+}
+
+// ParseRewrites parses a comma-separated list of from=to URL prefix pairs.
+func ParseRewrites(s string) (map[string]string, error) {
+	rewrites := map[string]string{}
+	if s == "" {
+		return rewrites, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || from == "" {
+			return nil, fmt.Errorf("invalid rewrite %q, expected from=to", pair)
+		}
+		rewrites[from] = to
+	}
+	return rewrites, nil
+}
+
+func (e Endpoints) clone() Endpoints {
+	c := e
+	c.Artifacts = make(map[string]string, len(e.Artifacts))
+	for k, v := range e.Artifacts {
+		c.Artifacts[k] = v
+	}
+	c.GCSBuckets = append([]string(nil), e.GCSBuckets...)
+	c.Rewrites = make(map[string]string, len(e.Rewrites))
+	for k, v := range e.Rewrites {
+		c.Rewrites[k] = v
+	}
+	return c
+}
+
+func (e *Endpoints) merge(o Endpoints) {
+	if o.GitHubAPI != "" {
+		e.GitHubAPI = o.GitHubAPI
+	}
+	if o.PayloadTests != "" {
+		e.PayloadTests = o.PayloadTests
+	}
+	for k, v := range o.Artifacts {
+		e.Artifacts[k] = v
+	}
+	if o.GCS != "" {
+		e.GCS = o.GCS
+	}
+	e.GCSBuckets = append(e.GCSBuckets, o.GCSBuckets...)
+	for k, v := range o.Rewrites {
+		e.Rewrites[k] = v
+	}
+}
+
+// WithRewrites returns a copy of the endpoints with the given rewrites added.
+func (e Endpoints) WithRewrites(rewrites map[string]string) Endpoints {
+	c := e.clone()
+	c.merge(Endpoints{Rewrites: rewrites})
+	return c
+}
+
+// artifactURL returns the URL from which an artifact of the given prow job
+// can be downloaded. The artifact path is relative to the job.
+func (e Endpoints) artifactURL(jobURL, artifact string) (string, error) {
+	if bucket, prefix, ok := e.gcsLocation(jobURL); ok {
+		return e.gcsObjectURL(bucket, path.Join(prefix, artifact)), nil
+	}
+	from, to, ok := longestPrefix(e.Artifacts, jobURL)
+	if !ok {
+		return "", fmt.Errorf("don't know where to find the artifacts of %q", jobURL)
+	}
+	u, err := url.Parse(to + strings.TrimPrefix(jobURL, from))
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, artifact)
+	return u.String(), nil
+}
+
+// rewrite maps u to the location it should be fetched from.
+func (e Endpoints) rewrite(u string) string {
+	if from, to, ok := longestPrefix(e.Rewrites, u); ok {
+		return to + strings.TrimPrefix(u, from)
+	}
+	return u
+}
+
+// longestPrefix finds the longest key of m that is a prefix of s.
+func longestPrefix(m map[string]string, s string) (string, string, bool) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, k := range keys {
+		if strings.HasPrefix(s, k) {
+			return k, m[k], true
+		}
+	}
+	return "", "", false
+}
+
+// rewritingFetcher fetches URLs from where the endpoints say they are. The
+// responses keep the original URL, so callers can tell them apart.
+type rewritingFetcher struct {
+	fetcher   Fetcher
+	endpoints Endpoints
+}
+
+func newRewritingFetcher(f Fetcher, e Endpoints) Fetcher {
+	if len(e.Rewrites) == 0 {
+		return f
+	}
+	return &rewritingFetcher{fetcher: f, endpoints: e}
+}
+
+func (f *rewritingFetcher) Fetch(u string, header http.Header) (*Response, error) {
+	resp, err := f.fetcher.Fetch(f.endpoints.rewrite(u), header)
+	if resp != nil {
+		resp.URL = u
+	}
+	return resp, err
+}
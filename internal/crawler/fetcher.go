@@ -0,0 +1,263 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Fetcher retrieves the contents of a URL. Implementations only return an error
+// when the URL could not be fetched at all; HTTP-level failures are reported
+// through the StatusCode of the Response.
+type Fetcher interface {
+	Fetch(url string, header http.Header) (*Response, error)
+}
+
+// Response is what a Fetcher got back for a URL.
+type Response struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Status returns the status line of the response, e.g. "404 Not Found".
+func (r *Response) Status() string {
+	return fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode))
+}
+
+// OK tells whether the response was successful.
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// HTTPFetcher fetches URLs from live hosts.
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// NewHTTPFetcher returns a Fetcher that talks to live hosts. A nil client means
+// a default client with a sensible timeout. Tests may pass a client whose
+// transport points to an httptest server.
+func NewHTTPFetcher(client *http.Client) *HTTPFetcher {
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &HTTPFetcher{Client: client}
+}
+
+func (f *HTTPFetcher) Fetch(u string, header http.Header) (*Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	log.Println("Visiting", u)
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", u, err)
+	}
+	return &Response{
+		URL:        u,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}, nil
+}
+
+// FileFetcher serves recorded fixtures from a directory. A URL such as
+// https://host/a/b?c=d is read from <Dir>/host/a/b?c=d, and directories are
+// served from their index.html file.
+type FileFetcher struct {
+	Dir string
+}
+
+func NewFileFetcher(dir string) *FileFetcher {
+	return &FileFetcher{Dir: dir}
+}
+
+func (f *FileFetcher) Fetch(u string, _ http.Header) (*Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(f.Dir, parsed.Host, filepath.FromSlash(parsed.Path))
+	if parsed.RawQuery != "" {
+		file += "?" + parsed.RawQuery
+	}
+	if fi, err := os.Stat(file); err == nil && fi.IsDir() {
+		file = filepath.Join(file, "index.html")
+	}
+
+	body, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &Response{URL: u, StatusCode: http.StatusNotFound, Header: http.Header{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Response{URL: u, StatusCode: http.StatusOK, Header: http.Header{}, Body: body}, nil
+}
+
+// MemoryFetcher serves responses registered in memory. Unknown URLs yield a 404.
+type MemoryFetcher struct {
+	mu        sync.RWMutex
+	responses map[string]*Response
+}
+
+func NewMemoryFetcher() *MemoryFetcher {
+	return &MemoryFetcher{responses: make(map[string]*Response)}
+}
+
+// Add registers the response to be returned for u.
+func (f *MemoryFetcher) Add(u string, statusCode int, body []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[u] = &Response{URL: u, StatusCode: statusCode, Header: http.Header{}, Body: body}
+}
+
+// AddResponse registers a response with headers, e.g. a Link header, to be
+// returned for its URL.
+func (f *MemoryFetcher) AddResponse(r *Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[r.URL] = r
+}
+
+func (f *MemoryFetcher) Fetch(u string, _ http.Header) (*Response, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if r, ok := f.responses[u]; ok {
+		copied := *r
+		return &copied, nil
+	}
+	return &Response{URL: u, StatusCode: http.StatusNotFound, Header: http.Header{}}, nil
+}
+
+// limitedFetcher bounds the number of concurrent requests made to each host
+// and waits for a delay after each request before letting the next one in.
+type limitedFetcher struct {
+	fetcher     Fetcher
+	parallelism int
+	delay       time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func newLimitedFetcher(f Fetcher, parallelism int, delay time.Duration) Fetcher {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &limitedFetcher{
+		fetcher:     f,
+		parallelism: parallelism,
+		delay:       delay,
+		hosts:       make(map[string]chan struct{}),
+	}
+}
+
+func (f *limitedFetcher) Fetch(u string, header http.Header) (*Response, error) {
+	sem := f.semaphore(u)
+	sem <- struct{}{}
+	defer func() {
+		time.Sleep(f.delay)
+		<-sem
+	}()
+	return f.fetcher.Fetch(u, header)
+}
+
+func (f *limitedFetcher) semaphore(u string) chan struct{} {
+	host := u
+	if parsed, err := url.Parse(u); err == nil {
+		host = parsed.Host
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sem, ok := f.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, f.parallelism)
+		f.hosts[host] = sem
+	}
+	return sem
+}
+
+// retryingFetcher retries requests that failed for reasons that are likely
+// to be transient: network errors, throttling and server errors.
+type retryingFetcher struct {
+	fetcher  Fetcher
+	attempts int
+	backoff  time.Duration
+	// maxBackoff caps the wait between attempts, before jitter.
+	maxBackoff time.Duration
+}
+
+func newRetryingFetcher(f Fetcher, attempts int, backoff, maxBackoff time.Duration) Fetcher {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > MaxAttempts {
+		attempts = MaxAttempts
+	}
+	return &retryingFetcher{fetcher: f, attempts: attempts, backoff: backoff, maxBackoff: maxBackoff}
+}
+
+func (f *retryingFetcher) Fetch(u string, header http.Header) (*Response, error) {
+	var (
+		resp *Response
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		resp, err = f.fetcher.Fetch(u, header)
+		if !retriable(resp, err) || attempt == f.attempts {
+			return resp, err
+		}
+
+		// Back off exponentially, with up to 50% of jitter so that
+		// concurrent requests don't retry in lockstep.
+		wait := f.wait(attempt)
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		reason := fmt.Sprint(err)
+		if err == nil {
+			reason = resp.Status()
+		}
+		log.Printf("Attempt %d/%d for %q failed (%s), retrying in %s", attempt, f.attempts, u, reason, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+}
+
+// wait returns how long to back off after the given failed attempt, before jitter.
+func (f *retryingFetcher) wait(attempt int) time.Duration {
+	wait := f.backoff
+	for i := 1; i < attempt && wait < f.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > f.maxBackoff {
+		wait = f.maxBackoff
+	}
+	return wait
+}
+
+func retriable(resp *Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
@@ -0,0 +1,27 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryWait(t *testing.T) {
+	f := newRetryingFetcher(NewMemoryFetcher(), 100, time.Second, 30*time.Second).(*retryingFetcher)
+	if f.attempts != MaxAttempts {
+		t.Errorf("expected attempts to be capped at %d, got %d", MaxAttempts, f.attempts)
+	}
+	for _, tc := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	} {
+		if got := f.wait(tc.attempt); got != tc.want {
+			t.Errorf("wait(%d) = %s, expected %s", tc.attempt, got, tc.want)
+		}
+	}
+}
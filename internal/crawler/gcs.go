@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/bertinatto/testgrid/internal"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// gcsListing is a page of the response of the GCS JSON API when listing objects.
+type gcsListing struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// gcsLocation returns the bucket and object prefix where the artifacts of the
+// job live, if the job is in a bucket that is read through the GCS API. Job
+// URLs point to Spyglass, e.g. https://prow.ci.openshift.org/view/gs/<bucket>/logs/<job>/<build>.
+func (e Endpoints) gcsLocation(jobURL string) (string, string, bool) {
+	parsed, err := url.Parse(jobURL)
+	if err != nil {
+		return "", "", false
+	}
+	_, rest, ok := strings.Cut(parsed.Path, "/view/gs/")
+	if !ok {
+		return "", "", false
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	for _, b := range e.GCSBuckets {
+		if b == bucket {
+			return bucket, strings.Trim(prefix, "/"), true
+		}
+	}
+	return "", "", false
+}
+
+// gcsObjectURL returns the URL from which an object can be downloaded.
+func (e Endpoints) gcsObjectURL(bucket, object string) string {
+	u, err := url.Parse(e.GCS)
+	if err != nil {
+		u = &url.URL{}
+	}
+	u.Path = path.Join(u.Path, bucket, object)
+	return u.String()
+}
+
+// gcsListGlob restricts listings to the artifacts we are interested in. Job
+// prefixes hold thousands of objects, and this keeps listings to a single page.
+const gcsListGlob = "**{finished.json,install-status.txt,.xml,build-log.txt}"
+
+// gcsListURL returns the URL of a page of the objects whose names start with
+// prefix and match gcsListGlob.
+func (e Endpoints) gcsListURL(bucket, prefix, pageToken string) string {
+	u, err := url.Parse(e.GCS)
+	if err != nil {
+		u = &url.URL{}
+	}
+	u.Path = path.Join(u.Path, "storage/v1/b", bucket, "o")
+	query := url.Values{}
+	query.Set("prefix", prefix)
+	query.Set("matchGlob", gcsListGlob)
+	query.Set("fields", "items(name),nextPageToken")
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// isGCSListing tells whether the URL is a listing of objects in the GCS JSON API.
+func isGCSListing(u *url.URL) bool {
+	return strings.HasPrefix(u.Path, "/storage/v1/b/") && strings.HasSuffix(u.Path, "/o")
+}
+
+// splitByStorage separates the jobs whose artifacts are read through the GCS
+// API from the ones whose artifacts are found through their Spyglass page.
+func (c *Crawler) splitByStorage(jobURLs []string) ([]string, []string) {
+	spyglass, gcs := []string{}, []string{}
+	for _, u := range jobURLs {
+		if _, _, ok := c.endpoints.gcsLocation(u); ok {
+			gcs = append(gcs, u)
+		} else {
+			spyglass = append(spyglass, u)
+		}
+	}
+	return spyglass, gcs
+}
+
+// listGCSArtifacts lists the artifacts of the given jobs to find out where
+// their install status and JUnit files are. It also returns the URLs of the
+// finished.json files that are known not to exist yet, so they aren't fetched.
+func (c *Crawler) listGCSArtifacts(jobURLs []string) ([][]installCandidate, []string, sets.String) {
+	var mu sync.Mutex
+	installs := [][]installCandidate{}
+	junitURLs := []string{}
+	unfinished := sets.NewString()
+
+	listings := make(map[string]string, len(jobURLs))
+	for _, j := range jobURLs {
+		bucket, prefix, _ := c.endpoints.gcsLocation(j)
+		listings[c.endpoints.gcsListURL(bucket, prefix+"/", "")] = j
+	}
+	urls := make([]string, 0, len(listings))
+	for u := range listings {
+		urls = append(urls, u)
+	}
+
+	failed := func(u string, err error) {
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.URL == listings[u] },
+			func(j *internal.ProwJob) { j.InstallStatusFetchError = err.Error() },
+		)
+	}
+	c.visit(urls, failed, func(r *Response) {
+		jobURL := listings[r.URL]
+		bucket, prefix, _ := c.endpoints.gcsLocation(jobURL)
+		artifacts, err := c.listGCSObjects(r, bucket, prefix+"/")
+		if err != nil {
+			c.problems.add(r.URL, "error listing artifacts: %v", err)
+			failed(r.URL, err)
+			return
+		}
+
+		candidates := []installCandidate{}
+		for _, statusPath := range rankInstallStatus(artifacts) {
+			candidates = append(candidates, installCandidate{url: c.endpoints.gcsObjectURL(bucket, path.Join(prefix, statusPath)), source: installSource(statusPath)})
+		}
+		junit, logs := []string{}, []string{}
+		finished := false
+		for _, a := range artifacts {
+			switch {
+			case a == "finished.json":
+				finished = true
+			case isTestJUnit(a):
+				junit = append(junit, c.endpoints.gcsObjectURL(bucket, path.Join(prefix, a)))
+			}
+			if isInstallLog(a) {
+				logs = append(logs, c.endpoints.gcsObjectURL(bucket, path.Join(prefix, a)))
+			}
+		}
+
+		mu.Lock()
+		if !finished {
+			unfinished.Insert(c.endpoints.gcsObjectURL(bucket, path.Join(prefix, "finished.json")))
+		}
+		if len(candidates) > 0 {
+			installs = append(installs, candidates)
+		}
+		junitURLs = append(junitURLs, junit...)
+		mu.Unlock()
+
+		// Store what we have found to our global store.
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.URL == jobURL },
+			func(j *internal.ProwJob) {
+				if len(candidates) > 0 {
+					j.InstallStatusURL = candidates[0].url
+					j.InstallSource = candidates[0].source
+				}
+				if len(junit) > 0 {
+					j.JUnitURLs = junit
+				}
+				if len(logs) > 0 {
+					j.InstallLogURLs = logs
+				}
+			},
+		)
+	})
+
+	return installs, junitURLs, unfinished
+}
+
+// listGCSObjects returns the names of the objects in the listing, relative to
+// prefix. The first page of the listing is given; the others are fetched.
+func (c *Crawler) listGCSObjects(first *Response, bucket, prefix string) ([]string, error) {
+	names := []string{}
+	r := first
+	for {
+		var page gcsListing
+		if err := json.Unmarshal(r.Body, &page); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %q: %w", r.URL, err)
+		}
+		for _, item := range page.Items {
+			names = append(names, strings.TrimPrefix(item.Name, prefix))
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+
+		next := c.endpoints.gcsListURL(bucket, prefix, page.NextPageToken)
+		var err error
+		r, err = c.fetcher.Fetch(next, nil)
+		if err == nil && !r.OK() {
+			err = fmt.Errorf("%s", r.Status())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %q: %w", next, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Limits on how we back off when GitHub rate limits us.
+const (
+	// maxRateLimitWait is the longest we are willing to sleep when GitHub asks us to back off.
+	maxRateLimitWait = 2 * time.Minute
+	// minRateLimitWait is the shortest, so that a reset time that has already
+	// passed, e.g. because of clock skew, or a Retry-After of 0 don't make us
+	// retry in a tight loop.
+	minRateLimitWait = time.Second
+	// maxRateLimitRetries is how many times a request is retried after being
+	// rate limited before giving up.
+	maxRateLimitRetries = 3
+)
+
+// sleep is replaced in tests to avoid waiting for real.
+var sleep = time.Sleep
+
+// githubClient talks to the GitHub REST API. It authenticates with a token when
+// one is available, uses conditional requests to avoid spending rate limit on
+// pages that haven't changed and turns rate limiting into meaningful errors.
+type githubClient struct {
+	apiURL   string
+	token    string
+	cacheDir string
+	fetcher  Fetcher
+	etags    map[string]*githubPage
+}
+
+// githubPagesDir is the directory of the cache where GitHub pages are kept,
+// along with their ETags.
+const githubPagesDir = "github"
+
+// githubPage is a response from the GitHub API along with its validators.
+type githubPage struct {
+	URL  string    `json:"url"`
+	ETag string    `json:"etag"`
+	Link string    `json:"link"`
+	Body []byte    `json:"body"`
+	Time time.Time `json:"time"`
+}
+
+func newGitHubClient(fetcher Fetcher, apiURL, token, cacheDir string) *githubClient {
+	return &githubClient{
+		apiURL:   apiURL,
+		token:    token,
+		cacheDir: cacheDir,
+		fetcher:  fetcher,
+		etags:    make(map[string]*githubPage),
+	}
+}
+
+// get fetches url from the GitHub API. If we have seen the page before, the
+// request is made conditional on its ETag and the stored copy is returned when
+// GitHub replies with 304 Not Modified.
+func (g *githubClient) get(url string) (*githubPage, error) {
+	cached := g.load(url)
+
+	for retries := 0; ; retries++ {
+		header := http.Header{}
+		header.Set("Accept", "application/vnd.github+json")
+		header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if g.token != "" {
+			header.Set("Authorization", "Bearer "+g.token)
+		}
+		if cached != nil && cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+
+		resp, err := g.fetcher.Fetch(url, header)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %q: %w", url, err)
+		}
+		body := resp.Body
+
+		if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+			if n, err := strconv.Atoi(remaining); err == nil && n > 0 && n < 10 {
+				log.Printf("WARNING: only %d GitHub API requests left until %s", n, rateLimitReset(resp.Header).Format(time.Kitchen))
+			}
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			return cached, nil
+
+		case resp.StatusCode == http.StatusOK:
+			page := &githubPage{
+				URL:  url,
+				ETag: resp.Header.Get("ETag"),
+				Link: resp.Header.Get("Link"),
+				Body: body,
+				Time: time.Now(),
+			}
+			g.store(page)
+			return page, nil
+
+		case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+			wait, limited := rateLimitWait(resp.Header)
+			if !limited {
+				return nil, fmt.Errorf("GitHub denied access to %q (%s): %s", url, resp.Status(), githubMessage(body))
+			}
+			if wait > maxRateLimitWait || retries == maxRateLimitRetries {
+				return nil, g.rateLimitError(resp.Header)
+			}
+			if wait < minRateLimitWait {
+				wait = minRateLimitWait
+			}
+			log.Printf("GitHub asked us to back off, retrying %q in %s", url, wait)
+			sleep(wait)
+
+		default:
+			return nil, fmt.Errorf("unexpected response from GitHub for %q (%s): %s", url, resp.Status(), githubMessage(body))
+		}
+	}
+}
+
+func (g *githubClient) rateLimitError(h http.Header) error {
+	hint := "set -github-token, -github-token-file or GITHUB_TOKEN to raise the limit"
+	if g.token != "" {
+		hint = "wait for the limit to reset or use a different token"
+	}
+	return fmt.Errorf("GitHub API rate limit exceeded (limit %s), resets at %s: %s",
+		h.Get("X-RateLimit-Limit"), rateLimitReset(h).Format(time.RFC1123), hint)
+}
+
+// rateLimitWait tells whether the response is a rate limit rejection and how long to wait before retrying.
+func rateLimitWait(h http.Header) (time.Duration, bool) {
+	// Secondary rate limits come with a Retry-After header.
+	if s := h.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	// Primary rate limits are signaled by running out of requests.
+	if h.Get("X-RateLimit-Remaining") == "0" {
+		return time.Until(rateLimitReset(h)), true
+	}
+	return 0, false
+}
+
+func rateLimitReset(h http.Header) time.Time {
+	secs, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(secs, 0)
+}
+
+// githubMessage extracts the "message" field GitHub includes in error responses.
+func githubMessage(body []byte) string {
+	var e struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+		return string(body)
+	}
+	return e.Message
+}
+
+func (g *githubClient) load(url string) *githubPage {
+	if p, ok := g.etags[url]; ok {
+		return p
+	}
+	if g.cacheDir == "" {
+		return nil
+	}
+	p, err := readGitHubPage(g.pagePath(url))
+	if err != nil {
+		return nil
+	}
+	g.etags[url] = p
+	return p
+}
+
+func readGitHubPage(file string) (*githubPage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := &githubPage{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (g *githubClient) store(p *githubPage) {
+	g.etags[p.URL] = p
+	if g.cacheDir == "" || p.ETag == "" {
+		return
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	file := g.pagePath(p.URL)
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		log.Printf("error creating cache dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(file, data, 0640); err != nil {
+		log.Printf("error caching %q: %v", p.URL, err)
+	}
+}
+
+func (g *githubClient) pagePath(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(g.cacheDir, githubPagesDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// pullRequest has the parts of a GitHub pull request we care about.
+type pullRequest struct {
+	Head struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+func (g *githubClient) pullRequest(org, repo string, id int) (*pullRequest, error) {
+	page, err := g.get(fmt.Sprintf("%s/repos/%s/%s/pulls/%d", g.apiURL, org, repo, id))
+	if err != nil {
+		return nil, err
+	}
+	pr := &pullRequest{}
+	if err := json.Unmarshal(page.Body, pr); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %q: %w", page.URL, err)
+	}
+	return pr, nil
+}
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingFetcher counts the requests made through it.
+type countingFetcher struct {
+	Fetcher
+	requests int
+}
+
+func (f *countingFetcher) Fetch(u string, header http.Header) (*Response, error) {
+	f.requests++
+	return f.Fetcher.Fetch(u, header)
+}
+
+func TestGitHubRateLimitResetPassed(t *testing.T) {
+	waits := []time.Duration{}
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	const url = "https://api.github.com/repos/o/r/pulls/1"
+	for name, header := range map[string]http.Header{
+		"reset":       {"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"1"}},
+		"retry-after": {"Retry-After": []string{"0"}},
+	} {
+		waits = waits[:0]
+		m := NewMemoryFetcher()
+		m.AddResponse(&Response{URL: url, StatusCode: http.StatusForbidden, Header: header, Body: []byte(`{"message":"API rate limit exceeded"}`)})
+		f := &countingFetcher{Fetcher: m}
+
+		_, err := newGitHubClient(f, "https://api.github.com", "", "").get(url)
+		if err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+			t.Errorf("%s: expected a rate limit error, got %v", name, err)
+		}
+		if f.requests != maxRateLimitRetries+1 {
+			t.Errorf("%s: expected %d requests, got %d", name, maxRateLimitRetries+1, f.requests)
+		}
+		for _, w := range waits {
+			if w < minRateLimitWait {
+				t.Errorf("%s: expected to wait at least %s between requests, waited %s", name, minRateLimitWait, w)
+			}
+		}
+	}
+}
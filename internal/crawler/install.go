@@ -0,0 +1,379 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bertinatto/testgrid/internal"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// installStepRe matches the steps that install the cluster in the workflows
+// we know of, so their result can stand for the install status when nothing
+// better is available.
+var installStepRe = regexp.MustCompile(`^(` + strings.Join([]string{
+	`ipi-install-install.*`,        // IPI
+	`upi-install-.+`,               // UPI
+	`hypershift-.*create.*`,        // HyperShift hosted clusters
+	`rosa-cluster-provision`,       // ROSA
+	`osd-create-create`,            // OSD
+	`.*assisted.*-setup.*`,         // assisted installer
+	`.*agent.*-install.*`,          // agent-based installer
+	`baremetalds-devscripts-setup`, // metal IPI through dev-scripts
+}, "|") + `)$`)
+
+// Kinds of artifacts that tell the install status, from the most to the least reliable.
+const (
+	// installStatusTXT holds the exit code of the installer.
+	installStatusTXT = iota
+	// installJUnit is written by the install step, with a test case per install phase.
+	installJUnit
+	// installStepResult is the finished.json of the install step.
+	installStepResult
+)
+
+// installKind returns the kind of the artifact for telling the install status,
+// or -1 if it can't be used for that.
+func installKind(artifact string) int {
+	base := path.Base(artifact)
+	switch {
+	case base == "install-status.txt":
+		return installStatusTXT
+	case base == "junit_install.xml":
+		return installJUnit
+	case base == "finished.json" && installStepRe.MatchString(path.Base(path.Dir(artifact))):
+		return installStepResult
+	}
+	return -1
+}
+
+// rankInstallStatus returns the artifacts that may tell the install status
+// among the artifacts of a job, whose paths are relative to the job, from the
+// most to the least reliable.
+func rankInstallStatus(artifacts []string) []string {
+	candidates := []string{}
+	for _, a := range artifacts {
+		if installKind(a) >= 0 {
+			candidates = append(candidates, a)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ki, kj := installKind(candidates[i]), installKind(candidates[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates
+}
+
+// installCandidate is an artifact that may tell the install status of a job.
+type installCandidate struct {
+	url string
+	// source is what the report shows the status was taken from, see installSource.
+	source string
+}
+
+// installSource describes where the install status was taken from, e.g.
+// "ipi-install-install/artifacts/junit_install.xml". Artifacts are stored as
+// artifacts/<test>/<step>/..., the first two of which are left out.
+func installSource(artifact string) string {
+	parts := strings.SplitN(artifact, "/", 3)
+	if len(parts) == 3 && parts[0] == "artifacts" {
+		return parts[2]
+	}
+	return artifact
+}
+
+// parseInstallStatus reads the install status of the jobs, given the ranked
+// candidates of each job. Candidates may be missing, e.g. because they are
+// guessed rather than listed, in which case the next one is tried.
+func (c *Crawler) parseInstallStatus(jobs [][]installCandidate) {
+	for len(jobs) > 0 {
+		var mu sync.Mutex
+		fetched := sets.NewString()
+		urls := make([]string, 0, len(jobs))
+		for _, candidates := range jobs {
+			urls = append(urls, candidates[0].url)
+		}
+		c.readInstallStatus(urls, func(u string) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetched.Insert(u)
+		})
+
+		// Move on to the next candidate of the jobs whose artifact doesn't exist.
+		next := [][]installCandidate{}
+		for _, candidates := range jobs {
+			missing := candidates[0]
+			if fetched.Has(missing.url) {
+				continue
+			}
+			rest := candidates[1:]
+			c.data.update(
+				func(j *internal.ProwJob) bool { return j.InstallStatusURL == missing.url },
+				func(j *internal.ProwJob) {
+					j.InstallStatusURL, j.InstallSource = "", ""
+					if len(rest) > 0 {
+						j.InstallStatusURL, j.InstallSource = rest[0].url, rest[0].source
+					}
+				},
+			)
+			if len(rest) > 0 {
+				next = append(next, rest)
+			}
+		}
+		jobs = next
+	}
+}
+
+// readInstallStatus visits the given install status artifacts and stores the
+// status they tell. fetched is called with the URLs that exist, even if they
+// couldn't be read.
+func (c *Crawler) readInstallStatus(urls []string, fetched func(u string)) {
+	// Visit all install status files provided to this function.
+	failed := func(u string, err error) {
+		fetched(u)
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.InstallStatusURL == u },
+			func(j *internal.ProwJob) { j.InstallStatusFetchError = err.Error() },
+		)
+	}
+	c.visit(urls, failed, func(r *Response) {
+		fetched(r.URL)
+		var status string
+		switch installKind(r.URL) {
+		case installStatusTXT:
+			// Assume the installation succeeded if the install-status.txt
+			// file contains "0" otherwise assume that the it failed.
+			code, err := strconv.Atoi(string(bytes.TrimSpace(r.Body)))
+			if err != nil {
+				// This means the status is invalid, so leave it empty
+				return
+			}
+			status = "failure"
+			if code == 0 {
+				status = "success"
+			}
+
+		case installJUnit:
+			summary, err := summarizeJUnit(r.Body)
+			if err != nil {
+				c.problems.add(r.URL, "error unmarshalling JUnit file: %v", err)
+				return
+			}
+			switch {
+			case summary.Failed > 0:
+				status = "failure"
+			case summary.Passed > 0:
+				status = "success"
+			default:
+				return
+			}
+
+		case installStepResult:
+			var step struct {
+				Passed *bool  `json:"passed"`
+				Result string `json:"result"`
+			}
+			if err := json.Unmarshal(r.Body, &step); err != nil {
+				c.problems.add(r.URL, "error unmarshalling finished.json: %v", err)
+				return
+			}
+			switch {
+			case step.Result != "":
+				status = strings.ToLower(step.Result)
+			case step.Passed != nil && *step.Passed:
+				status = "success"
+			case step.Passed != nil:
+				status = "failure"
+			default:
+				return
+			}
+
+		default:
+			return
+		}
+
+		// Store the installation status to our global store.
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.InstallStatusURL == r.URL },
+			func(j *internal.ProwJob) { j.InstallStatus = status },
+		)
+	})
+}
+
+// isInstallLog tells whether the artifact may explain why the install failed.
+func isInstallLog(artifact string) bool {
+	base := path.Base(artifact)
+	return base == "junit_install.xml" || base == "build-log.txt" && installStepRe.MatchString(path.Base(path.Dir(artifact)))
+}
+
+// installErrorPhases classify install errors by their message, in order.
+// Quota and cloud API errors come first, since they may happen in any phase.
+var installErrorPhases = []struct {
+	phase string
+	re    *regexp.Regexp
+}{
+	{internal.PhaseCloudAPI, regexp.MustCompile(`(?i)quota|limit ?exceeded|insufficient\w*capacity|throttl|rate ?limit|too many requests`)},
+	{internal.PhaseBootstrap, regexp.MustCompile(`(?i)bootstrap|waiting for (the )?kubernetes api`)},
+	{internal.PhaseOperators, regexp.MustCompile(`(?i)cluster ?operators?\b.*\b(not available|unavailable|degraded)|failed to initialize the cluster`)},
+	{internal.PhaseInfrastructure, regexp.MustCompile(`(?i)terraform|infrastructure|failed to (create|provision)`)},
+	{internal.PhaseConfiguration, regexp.MustCompile(`(?i)install-config|invalid .*config`)},
+}
+
+func classifyInstallError(msg string) string {
+	for _, p := range installErrorPhases {
+		if p.re.MatchString(msg) {
+			return p.phase
+		}
+	}
+	return internal.PhaseOther
+}
+
+// junitInstallPhases maps the test cases of junit_install.xml, which are
+// named "install should succeed: <phase>", to install phases.
+var junitInstallPhases = map[string]string{
+	"configuration":     internal.PhaseConfiguration,
+	"infrastructure":    internal.PhaseInfrastructure,
+	"cluster bootstrap": internal.PhaseBootstrap,
+	"cluster creation":  internal.PhaseOperators,
+	"other":             internal.PhaseOther,
+}
+
+// classifyJUnitInstall tells in which phase the install failed according to
+// junit_install.xml, or nil if no phase failed.
+func classifyJUnitInstall(data []byte) (*internal.InstallFailure, error) {
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	var failure *internal.InstallFailure
+	var walk func(s *junitSuite)
+	walk = func(s *junitSuite) {
+		for _, tc := range s.Cases {
+			f := tc.Failure
+			if f == nil {
+				f = tc.Error
+			}
+			phase, ok := junitInstallPhases[strings.TrimPrefix(tc.Name, "install should succeed: ")]
+			if f == nil || !ok || failure != nil {
+				continue
+			}
+			reason := oneLine(f.Message + "\n" + f.Text)
+			if classifyInstallError(reason) == internal.PhaseCloudAPI {
+				phase = internal.PhaseCloudAPI
+			}
+			failure = &internal.InstallFailure{Phase: phase, Reason: reason}
+		}
+		for i := range s.Suites {
+			walk(&s.Suites[i])
+		}
+	}
+	walk(&root)
+	return failure, nil
+}
+
+// installLogErrorRe matches the errors logged by openshift-install, e.g.
+// level=fatal msg="failed to initialize the cluster: Cluster operator console is not available".
+var installLogErrorRe = regexp.MustCompile(`level=(error|fatal) msg="((?:[^"\\]|\\.)*)"`)
+
+// classifyInstallLog tells in which phase the install failed according to the
+// output of openshift-install, or nil if it didn't log any error. The fatal
+// error is the most telling, unless a quota or cloud API error was logged.
+func classifyInstallLog(data []byte) *internal.InstallFailure {
+	var fatal, first, cloud string
+	for _, m := range installLogErrorRe.FindAllSubmatch(data, -1) {
+		msg := string(m[2])
+		if unquoted, err := strconv.Unquote(`"` + msg + `"`); err == nil {
+			msg = unquoted
+		}
+		switch {
+		case cloud == "" && classifyInstallError(msg) == internal.PhaseCloudAPI:
+			cloud = msg
+		case string(m[1]) == "fatal":
+			fatal = msg
+		case first == "":
+			first = msg
+		}
+	}
+
+	switch {
+	case cloud != "":
+		return &internal.InstallFailure{Phase: internal.PhaseCloudAPI, Reason: oneLine(cloud)}
+	case fatal != "":
+		return &internal.InstallFailure{Phase: classifyInstallError(fatal), Reason: oneLine(fatal)}
+	case first != "":
+		return &internal.InstallFailure{Phase: classifyInstallError(first), Reason: oneLine(first)}
+	}
+	return nil
+}
+
+// maxReasonLength is the most characters of a failure reason shown in the report.
+const maxReasonLength = 200
+
+// oneLine returns the first non-empty line of s, shortened if needed.
+func oneLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if r := []rune(line); len(r) > maxReasonLength {
+			line = string(r[:maxReasonLength]) + "…"
+		}
+		return line
+	}
+	return ""
+}
+
+// classifyInstallFailures looks into the logs of the jobs whose install
+// failed, to tell in which phase and why. junit_install.xml is preferred; the
+// build logs of the install steps are only looked into when it's missing or
+// doesn't tell.
+func (c *Crawler) classifyInstallFailures() {
+	for _, junit := range []bool{true, false} {
+		urls := []string{}
+		c.data.update(
+			func(j *internal.ProwJob) bool { return j.InstallStatus == "failure" && j.InstallFailure == nil },
+			func(j *internal.ProwJob) {
+				for _, u := range j.InstallLogURLs {
+					if (path.Base(u) == "junit_install.xml") == junit {
+						urls = append(urls, u)
+					}
+				}
+			},
+		)
+
+		c.visit(urls, nil, func(r *Response) {
+			var failure *internal.InstallFailure
+			if junit {
+				var err error
+				failure, err = classifyJUnitInstall(r.Body)
+				if err != nil {
+					c.problems.add(r.URL, "error unmarshalling JUnit file: %v", err)
+					return
+				}
+			} else {
+				failure = classifyInstallLog(r.Body)
+			}
+			if failure == nil {
+				return
+			}
+
+			// Store the failure to our global store.
+			c.data.update(
+				func(j *internal.ProwJob) bool { return j.InstallFailure == nil && contains(j.InstallLogURLs, r.URL) },
+				func(j *internal.ProwJob) { j.InstallFailure = failure },
+			)
+		})
+	}
+}
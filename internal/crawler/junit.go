@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bertinatto/testgrid/internal"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// junitFileRe matches the JUnit files written by openshift-tests, e.g. junit_e2e__20231206-201334.xml.
+var junitFileRe = regexp.MustCompile(`^junit.*\.xml$`)
+
+// isE2EJUnit tells whether the artifact is a JUnit file produced by the openshift-e2e-test step.
+func isE2EJUnit(artifact string) bool {
+	return strings.Contains(artifact, "/openshift-e2e-test/") && junitFileRe.MatchString(path.Base(artifact))
+}
+
+// junitSuite covers both <testsuites> and <testsuite> documents, which may be nested.
+type junitSuite struct {
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name    string        `xml:"name,attr"`
+	Failure *junitFailure `xml:"failure"`
+	Error   *junitFailure `xml:"error"`
+	Skipped *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (c *Crawler) parseJUnit(urls []string) {
+	// Visit all JUnit files provided to this function.
+	c.visit(urls, nil, func(r *Response) {
+		summary, err := summarizeJUnit(r.Body)
+		if err != nil {
+			c.problems.add(r.URL, "error unmarshalling JUnit file: %v", err)
+			return
+		}
+
+		// A job may have more than one JUnit file, so add up the results.
+		c.data.update(
+			func(j *internal.ProwJob) bool { return contains(j.JUnitURLs, r.URL) },
+			func(j *internal.ProwJob) {
+				if j.Tests == nil {
+					j.Tests = &internal.TestSummary{}
+				}
+				j.Tests.Add(summary)
+			},
+		)
+	})
+}
+
+// summarizeJUnit counts the test cases in a JUnit document. openshift-tests
+// retries failed tests and reports both attempts, so a test that failed and
+// then passed is counted as a flake rather than a failure.
+func summarizeJUnit(data []byte) (*internal.TestSummary, error) {
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	passed, failed := sets.NewString(), sets.NewString()
+	summary := &internal.TestSummary{}
+	var walk func(s *junitSuite)
+	walk = func(s *junitSuite) {
+		for _, tc := range s.Cases {
+			switch {
+			case tc.Failure != nil || tc.Error != nil:
+				failed.Insert(tc.Name)
+			case tc.Skipped != nil:
+				summary.Skipped++
+			default:
+				passed.Insert(tc.Name)
+			}
+		}
+		for i := range s.Suites {
+			walk(&s.Suites[i])
+		}
+	}
+	walk(&root)
+
+	summary.Passed = passed.Difference(failed).Len()
+	summary.Flaked = failed.Intersection(passed).Len()
+	summary.FailedTests = failed.Difference(passed).List()
+	summary.Failed = len(summary.FailedTests)
+	return summary, nil
+}
+
+func contains(slice []string, target string) bool {
+	for _, s := range slice {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
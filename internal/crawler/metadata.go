@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bertinatto/testgrid/internal"
+)
+
+// startedJSON is the started.json file written by prow when a job starts.
+type startedJSON struct {
+	Timestamp int64 `json:"timestamp"`
+	// Repos maps "org/repo" to the refs under test, e.g. "master:base_sha,1558:pr_sha".
+	Repos map[string]string `json:"repos"`
+}
+
+// prowJobJSON has the parts of the ProwJob custom resource we care about.
+type prowJobJSON struct {
+	Spec struct {
+		Refs      *prowRefs  `json:"refs"`
+		ExtraRefs []prowRefs `json:"extra_refs"`
+		PodSpec   struct {
+			Containers []struct {
+				Env []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"env"`
+			} `json:"containers"`
+		} `json:"pod_spec"`
+	} `json:"spec"`
+	Status struct {
+		StartTime      time.Time `json:"startTime"`
+		CompletionTime time.Time `json:"completionTime"`
+		BuildID        string    `json:"build_id"`
+		State          string    `json:"state"`
+	} `json:"status"`
+}
+
+type prowRefs struct {
+	Org   string `json:"org"`
+	Repo  string `json:"repo"`
+	Pulls []struct {
+		Number int    `json:"number"`
+		SHA    string `json:"sha"`
+	} `json:"pulls"`
+}
+
+// jobArtifact returns a predicate that matches the job owning the given artifact URL.
+func (c *Crawler) jobArtifact(u, artifact string) func(j *internal.ProwJob) bool {
+	return func(j *internal.ProwJob) bool {
+		a, err := c.endpoints.artifactURL(j.URL, artifact)
+		return err == nil && a == u
+	}
+}
+
+func (c *Crawler) parseStartedJSON(urls []string) {
+	// Visit all started.json files provided to this function.
+	c.visit(urls, nil, func(r *Response) {
+		var started startedJSON
+		if err := json.Unmarshal(r.Body, &started); err != nil {
+			c.problems.add(r.URL, "error unmarshalling started.json: %v", err)
+			return
+		}
+		sha := pullSHA(started.Repos[c.org+"/"+c.repo], c.pullRequestID)
+
+		// Store the metadata to our global store.
+		c.data.update(c.jobArtifact(r.URL, "started.json"), func(j *internal.ProwJob) {
+			if started.Timestamp != 0 {
+				j.StartTime = time.Unix(started.Timestamp, 0)
+			}
+			if j.PRHeadSHA == "" {
+				j.PRHeadSHA = sha
+			}
+		})
+	})
+}
+
+func (c *Crawler) parseProwJobJSON(urls []string) {
+	// Visit all prowjob.json files provided to this function.
+	c.visit(urls, nil, func(r *Response) {
+		var pj prowJobJSON
+		if err := json.Unmarshal(r.Body, &pj); err != nil {
+			c.problems.add(r.URL, "error unmarshalling prowjob.json: %v", err)
+			return
+		}
+
+		// The pull request may be among the refs of the job or, for
+		// payload jobs testing several PRs, among its extra refs.
+		sha := ""
+		refs := pj.Spec.ExtraRefs
+		if pj.Spec.Refs != nil {
+			refs = append(refs, *pj.Spec.Refs)
+		}
+		for _, ref := range refs {
+			if ref.Org != c.org || ref.Repo != c.repo {
+				continue
+			}
+			for _, pull := range ref.Pulls {
+				if pull.Number == c.pullRequestID {
+					sha = pull.SHA
+				}
+			}
+		}
+
+		image := ""
+		for _, container := range pj.Spec.PodSpec.Containers {
+			for _, env := range container.Env {
+				if env.Name == "RELEASE_IMAGE_LATEST" {
+					image = env.Value
+				}
+			}
+		}
+
+		// Store the metadata to our global store.
+		c.data.update(c.jobArtifact(r.URL, "prowjob.json"), func(j *internal.ProwJob) {
+			if pj.Status.BuildID != "" {
+				j.BuildID = pj.Status.BuildID
+			}
+			if j.StartTime.IsZero() {
+				j.StartTime = pj.Status.StartTime
+			}
+			if j.FinishTime.IsZero() {
+				j.FinishTime = pj.Status.CompletionTime
+			}
+			if sha != "" {
+				j.PRHeadSHA = sha
+			}
+			j.ReleaseImage = image
+			j.State = pj.Status.State
+		})
+	})
+}
+
+// pullSHA extracts the commit of a pull request from a refs string as found
+// in started.json, e.g. "master:abc123,1558:def456".
+func pullSHA(refs string, prID int) string {
+	for _, ref := range strings.Split(refs, ",") {
+		number, sha, ok := strings.Cut(ref, ":")
+		if ok && number == fmt.Sprint(prID) {
+			return sha
+		}
+	}
+	return ""
+}
+
+// buildID returns the build ID of a job from its URL, which always ends with it.
+func buildID(jobURL string) string {
+	return path.Base(strings.TrimSuffix(jobURL, "/"))
+}
+
+// markPending flags the jobs that haven't finished yet. Running jobs have
+// a started.json but no finished.json, and prow also tells us their state.
+// Jobs that prow considers done but never wrote a finished.json (e.g. because
+// they were aborted) get their result from the prow job state instead.
+func (c *Crawler) markPending() {
+	c.data.update(
+		func(j *internal.ProwJob) bool { return j.Result == "" && j.ResultFetchError == "" },
+		func(j *internal.ProwJob) {
+			switch j.State {
+			case "success", "failure", "aborted", "error":
+				j.Result = j.State
+			case "triggered", "pending":
+				j.Result = internal.Pending
+			case "":
+				if !j.StartTime.IsZero() {
+					j.Result = internal.Pending
+				}
+			}
+			if j.Result == internal.Pending && j.InstallStatus == "" && j.InstallStatusFetchError == "" {
+				j.InstallStatus = internal.Pending
+			}
+		},
+	)
+}
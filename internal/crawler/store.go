@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bertinatto/testgrid/internal"
+)
+
+// jobStore holds the prow jobs found so far, indexed by job name. It is safe
+// for concurrent use, so stages can update jobs as responses come in.
+type jobStore struct {
+	mu   sync.RWMutex
+	jobs map[string][]*internal.ProwJob
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string][]*internal.ProwJob, 128)}
+}
+
+// add stores a new job run.
+func (s *jobStore) add(j *internal.ProwJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.Name] = append(s.jobs[j.Name], j)
+}
+
+// update calls fn for every job matching the given predicate.
+func (s *jobStore) update(match func(j *internal.ProwJob) bool, fn func(j *internal.ProwJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, values := range s.jobs {
+		for _, j := range values {
+			if match(j) {
+				fn(j)
+			}
+		}
+	}
+}
+
+// snapshot returns a copy of the index. The jobs themselves are shared.
+func (s *jobStore) snapshot() map[string][]*internal.ProwJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make(map[string][]*internal.ProwJob, len(s.jobs))
+	for k, v := range s.jobs {
+		jobs[k] = append([]*internal.ProwJob(nil), v...)
+	}
+	return jobs
+}
+
+// problemList collects the problems found while crawling. It is safe for concurrent use.
+type problemList struct {
+	mu       sync.Mutex
+	problems []internal.CrawlProblem
+}
+
+func (l *problemList) add(url, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.problems = append(l.problems, internal.CrawlProblem{URL: url, Message: fmt.Sprintf(format, args...)})
+}
+
+// list returns the problems sorted by URL, so reports are stable across runs.
+func (l *problemList) list() []internal.CrawlProblem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	problems := append([]internal.CrawlProblem(nil), l.problems...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].URL < problems[j].URL })
+	return problems
+}
+
+// forget drops the problems for the urls matching the given predicate.
+func (l *problemList) forget(match func(url string) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kept := l.problems[:0]
+	for _, p := range l.problems {
+		if !match(p.URL) {
+			kept = append(kept, p)
+		}
+	}
+	l.problems = kept
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PullRequest identifies a GitHub pull request.
+type PullRequest struct {
+	Org    string
+	Repo   string
+	Number int
+}
+
+var (
+	// pullRequestRefRe matches references such as openshift/api#1234.
+	pullRequestRefRe = regexp.MustCompile(`^([\w.-]+)/([\w.-]+?)(?:\.git)?#(\d+)$`)
+	// pullRequestURLRe matches URLs such as https://github.com/openshift/api/pull/1234/files.
+	pullRequestURLRe = regexp.MustCompile(`^https?://(?:www\.)?github\.com/([\w.-]+)/([\w.-]+?)(?:\.git)?/pulls?/(\d+)(?:[/?#].*)?$`)
+)
+
+// ParsePullRequest parses a reference to a pull request, either in the
+// org/repo#N form or as the URL of its page.
+func ParsePullRequest(s string) (PullRequest, error) {
+	s = strings.TrimSpace(s)
+	m := pullRequestRefRe.FindStringSubmatch(s)
+	if m == nil {
+		m = pullRequestURLRe.FindStringSubmatch(s)
+	}
+	if m == nil {
+		return PullRequest{}, fmt.Errorf("invalid pull request %q, expected org/repo#N or https://github.com/org/repo/pull/N", s)
+	}
+	n, err := strconv.Atoi(m[3])
+	if err != nil {
+		return PullRequest{}, fmt.Errorf("invalid pull request number in %q: %w", s, err)
+	}
+	return PullRequest{Org: m[1], Repo: m[2], Number: n}, nil
+}
+
+func (pr PullRequest) String() string {
+	return fmt.Sprintf("%s/%s#%d", pr.Org, pr.Repo, pr.Number)
+}
+
+// URL returns the address of the pull request page.
+func (pr PullRequest) URL() string {
+	return fmt.Sprintf("https://github.com/%s/%s/pull/%d", pr.Org, pr.Repo, pr.Number)
+}
+
+// SameCommit compares two commit SHAs, either of which may be abbreviated.
+func SameCommit(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a != "" && strings.HasPrefix(b, a)
+}
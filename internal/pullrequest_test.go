@@ -0,0 +1,102 @@
+package internal
+
+import "testing"
+
+func TestParsePullRequest(t *testing.T) {
+	want := PullRequest{Org: "openshift", Repo: "api", Number: 1234}
+	for _, in := range []string{
+		"openshift/api#1234",
+		" openshift/api#1234 ",
+		"openshift/api.git#1234",
+		"https://github.com/openshift/api/pull/1234",
+		"https://github.com/openshift/api/pull/1234/files",
+		"https://www.github.com/openshift/api/pulls/1234?w=1",
+		"http://github.com/openshift/api.git/pull/1234#issuecomment-1",
+	} {
+		got, err := ParsePullRequest(in)
+		if err != nil {
+			t.Errorf("ParsePullRequest(%q) returned error %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParsePullRequest(%q) = %v, expected %v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"1234",
+		"openshift/api",
+		"openshift#1234",
+		"openshift/api#",
+		"https://gitlab.com/openshift/api/pull/1234",
+		"https://github.com/openshift/api/issues/1234",
+	} {
+		if got, err := ParsePullRequest(in); err == nil {
+			t.Errorf("ParsePullRequest(%q) = %v, expected an error", in, got)
+		}
+	}
+}
+
+func TestPullRequestString(t *testing.T) {
+	pr := PullRequest{Org: "openshift", Repo: "api", Number: 1234}
+	if got := pr.String(); got != "openshift/api#1234" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := pr.URL(); got != "https://github.com/openshift/api/pull/1234" {
+		t.Errorf("URL() = %q", got)
+	}
+}
+
+func TestVersionForBranch(t *testing.T) {
+	dev, err := ParseBranchVersions("master=4.17, main=4.17")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		branch string
+		want   string
+	}{
+		{"release-4.15", "4.15"},
+		{"openshift-4.14", "4.14"},
+		{"master", "4.17"},
+		{"main", "4.17"},
+		{"feature-branch", ""},
+		{"release-4.15-backport", ""},
+	} {
+		got, ok := VersionForBranch(tc.branch, dev)
+		if tc.want == "" {
+			if ok {
+				t.Errorf("VersionForBranch(%q) = %v, expected none", tc.branch, got)
+			}
+			continue
+		}
+		if !ok || got.String() != tc.want {
+			t.Errorf("VersionForBranch(%q) = %v, %v, expected %s", tc.branch, got, ok, tc.want)
+		}
+	}
+
+	for _, in := range []string{"master", "master=", "=4.16", "master=latest"} {
+		if _, err := ParseBranchVersions(in); err == nil {
+			t.Errorf("ParseBranchVersions(%q) succeeded, expected an error", in)
+		}
+	}
+}
+
+func TestSameCommit(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"abc123", "abc123", true},
+		{"abc", "abc123", true},
+		{"abc123", "abc", true},
+		{"abd", "abc123", false},
+		{"", "abc123", false},
+		{"", "", false},
+	} {
+		if got := SameCommit(tc.a, tc.b); got != tc.want {
+			t.Errorf("SameCommit(%q, %q) = %v, expected %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bertinatto/testgrid/internal"
+	"github.com/bertinatto/testgrid/internal/variants"
+)
+
+// commitMatrix is the matrix for the runs that tested a single commit of the PR.
+type commitMatrix struct {
+	SHA string
+	// Head is set for the commit the PR currently points to.
+	Head bool
+	// Tested is when the first run for this commit started.
+	Tested time.Time
+	Data   map[string]internal.Entry
+}
+
+// buildHistory groups the jobs by the PR commit they tested and builds one
+// matrix per commit, newest first. Cells that differ from the previous commit
+// are flagged as changed. Jobs for which the commit is unknown are left out.
+func buildHistory(jobs []*internal.ProwJob, headSHAs []string, known *variants.Set) []commitMatrix {
+	byCommit := map[string][]*internal.ProwJob{}
+	tested := map[string]time.Time{}
+	for _, pj := range jobs {
+		if pj.PRHeadSHA == "" {
+			continue
+		}
+		byCommit[pj.PRHeadSHA] = append(byCommit[pj.PRHeadSHA], pj)
+		// Runs whose start time is unknown don't tell when the commit was tested.
+		if t := tested[pj.PRHeadSHA]; !pj.StartTime.IsZero() && (t.IsZero() || pj.StartTime.Before(t)) {
+			tested[pj.PRHeadSHA] = pj.StartTime
+		}
+	}
+
+	history := make([]commitMatrix, 0, len(byCommit))
+	for sha, jobs := range byCommit {
+		// Every matrix is about a single commit, so there is no point in
+		// marking cells as outdated.
+		matrix, _, _ := buildMatrix(jobs, known, false)
+		history = append(history, commitMatrix{SHA: shortSHA(sha), Head: isHead(sha, headSHAs), Tested: tested[sha], Data: matrix})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		// Commits never tested at a known time go last, in a stable order.
+		if !history[i].Tested.Equal(history[j].Tested) {
+			return history[i].Tested.After(history[j].Tested)
+		}
+		return history[i].SHA < history[j].SHA
+	})
+
+	for i := 0; i+1 < len(history); i++ {
+		diffMatrix(history[i].Data, history[i+1].Data)
+	}
+	return history
+}
+
+// isHead tells whether sha is one of the commits the PRs currently point to.
+func isHead(sha string, headSHAs []string) bool {
+	for _, h := range headSHAs {
+		if internal.SameCommit(sha, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffMatrix flags the cells of newer whose result differs from older.
+func diffMatrix(newer, older map[string]internal.Entry) {
+	for variant, e := range newer {
+		prev, ok := older[variant]
+		if !ok {
+			continue
+		}
+		prevCells := prev.Cells()
+		for i, c := range e.Cells() {
+			diffCell(c, *prevCells[i])
+		}
+		newer[variant] = e
+	}
+}
+
+func diffCell(c *internal.Cell, prev internal.Cell) {
+	if c.Result == "" || prev.Result == "" || c.Result == prev.Result {
+		return
+	}
+	c.Previous = prev.Result
+}
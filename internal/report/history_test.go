@@ -0,0 +1,50 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bertinatto/testgrid/internal"
+)
+
+func TestBuildHistoryOrder(t *testing.T) {
+	now := time.Now()
+	jobs := []*internal.ProwJob{
+		// The first run of each commit has no start time, e.g. because its
+		// started.json couldn't be fetched.
+		{Name: testJob, Version: "4.15", Result: "failure", PRHeadSHA: "older"},
+		{Name: testJob, Version: "4.15", Result: "failure", PRHeadSHA: "older", StartTime: now.Add(-5 * time.Hour)},
+		{Name: testJob, Version: "4.15", Result: "success", PRHeadSHA: "newer"},
+		{Name: testJob, Version: "4.15", Result: "success", PRHeadSHA: "newer", StartTime: now.Add(-3 * time.Hour)},
+		{Name: testJob, Version: "4.15", Result: "success", PRHeadSHA: "untimed"},
+	}
+
+	// Map iteration is random, so try a few times.
+	for i := 0; i < 20; i++ {
+		history := buildHistory(jobs, []string{"newer"}, testVariants())
+		got := []string{}
+		for _, h := range history {
+			got = append(got, h.SHA)
+		}
+		if len(got) != 3 || got[0] != "newer" || got[1] != "older" || got[2] != "untimed" {
+			t.Fatalf("expected commits newer, older, untimed, got %v", got)
+		}
+		if !history[0].Head || !history[0].Tested.Equal(now.Add(-3*time.Hour)) {
+			t.Errorf("expected the head commit to be tested 3h ago, got %+v", history[0])
+		}
+		if cell := history[0].Data["aws,amd64,ovn,ha"].Parallel; cell.Previous != "failure" {
+			t.Errorf("expected the head commit to be compared with the older one, got %+v", cell)
+		}
+	}
+}
+
+func TestBuildHistoryAbbreviatedHead(t *testing.T) {
+	jobs := []*internal.ProwJob{
+		// The run only knows an abbreviated SHA, e.g. from started.json.
+		{Name: testJob, Version: "4.15", Result: "success", PRHeadSHA: "abc1234", StartTime: time.Now()},
+	}
+	history := buildHistory(jobs, []string{"abc1234def5678"}, testVariants())
+	if len(history) != 1 || !history[0].Head {
+		t.Errorf("expected the abbreviated commit to be the head, got %+v", history)
+	}
+}
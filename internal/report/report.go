@@ -5,121 +5,433 @@ import (
 	"html/template"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/bertinatto/testgrid/html"
 	"github.com/bertinatto/testgrid/internal"
+	"github.com/bertinatto/testgrid/internal/variants"
 	"github.com/bertinatto/testgrid/variants/generated"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// These are the ways runs that tested an outdated commit of the PR can be handled.
+const (
+	// OutdatedExclude leaves outdated runs out of the matrix.
+	OutdatedExclude = "exclude"
+	// OutdatedMark shows outdated runs, but only if there's no result for the head commit.
+	OutdatedMark = "mark"
+	// OutdatedInclude treats outdated runs like any other, without marking them.
+	OutdatedInclude = "include"
 )
 
 type Report struct {
-	title       string
-	url         string
-	tmpl        *template.Template
-	matrix      map[string]internal.Entry
-	version     string
-	prevVersion string
+	pulls    []*pullRequest
+	tmpl     *template.Template
+	versions []*versionMatrix
+	problems []internal.CrawlProblem
+	variants *variants.Set
+	outdated string
+	excluded int
+	history  bool
+}
+
+// pullRequest is a pull request whose jobs are in the report.
+type pullRequest struct {
+	Title string
+	URL   string
+	// HeadSHA is the abbreviated commit the PR currently points to.
+	HeadSHA string
+	pr      internal.PullRequest
+	headSHA string
+}
+
+// versionMatrix is the matrix for the jobs of a single OCP version.
+type versionMatrix struct {
+	Version string
+	// PrevVersion is the release before Version, if known.
+	PrevVersion string
+	Data        map[string]internal.Entry
+	// History has one matrix per PR commit, if enabled.
+	History []commitMatrix
+}
+
+// table is what the "table" template renders.
+type table struct {
+	PrevVersion string
+	Data        map[string]internal.Entry
+}
+
+// Table returns a table for data, which is either the matrix of the version
+// or one of its history matrices.
+func (v *versionMatrix) Table(data map[string]internal.Entry) table {
+	return table{PrevVersion: v.PrevVersion, Data: data}
+}
+
+// New creates a report for the jobs of the given pull request. Versions must
+// be added before creating the report.
+func New(pr internal.PullRequest) *Report {
+	r := &Report{
+		tmpl:     template.Must(template.New("").ParseFS(html.FS, "*.tmpl")),
+		variants: variants.NewSet(generated.Variants),
+		outdated: OutdatedExclude,
+	}
+	r.AddPullRequest(pr)
+	return r
+}
+
+// AddPullRequest adds another pull request to the report, e.g. a backport of
+// the first one to another release.
+func (r *Report) AddPullRequest(pr internal.PullRequest) {
+	for _, p := range r.pulls {
+		if p.pr == pr {
+			return
+		}
+	}
+	r.pulls = append(r.pulls, &pullRequest{Title: pr.String(), URL: pr.URL(), pr: pr})
+}
+
+// AddVersion adds a matrix for the jobs of an OCP version. There's one matrix
+// per version, e.g. for PRs that are backported to several releases, shown
+// in the order their versions were added.
+func (r *Report) AddVersion(version internal.Version) {
+	for _, v := range r.versions {
+		if v.Version == version.String() {
+			return
+		}
+	}
+	v := &versionMatrix{
+		Version: version.String(),
+		Data:    make(map[string]internal.Entry, 128),
+	}
+	if prev, ok := version.Previous(); ok {
+		v.PrevVersion = prev.String()
+	}
+	r.versions = append(r.versions, v)
+}
+
+// SetOutdatedRuns sets how runs against outdated commits of the PR are handled.
+func (r *Report) SetOutdatedRuns(mode string) error {
+	switch mode {
+	case OutdatedExclude, OutdatedMark, OutdatedInclude:
+		r.outdated = mode
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q for outdated runs, expected one of: %s, %s, %s", mode, OutdatedExclude, OutdatedMark, OutdatedInclude)
+}
+
+// SetVariants sets the variants of the jobs, usually loaded at runtime. Jobs
+// missing from the set are looked up in the built-in variants.
+func (r *Report) SetVariants(s *variants.Set) {
+	r.variants = s.Fallback(generated.Variants)
+}
+
+// SetHistory enables rendering one matrix per PR commit besides the main one.
+func (r *Report) SetHistory(enabled bool) {
+	r.history = enabled
 }
 
-func New(curVer, prevVer string, org, repo string, prID int) *Report {
-	return &Report{
-		title:       fmt.Sprintf("%s/%s#%d", org, repo, prID),
-		url:         fmt.Sprintf("https://github.com/%s/%s/pull/%d", org, repo, prID),
-		matrix:      make(map[string]internal.Entry, 128),
-		tmpl:        template.Must(template.New("").ParseFS(html.FS, "*.tmpl")),
-		version:     curVer,
-		prevVersion: prevVer,
+// SetHeadCommit records the commit a PR of the report currently points to.
+func (r *Report) SetHeadCommit(pr internal.PullRequest, sha string) {
+	for _, p := range r.pulls {
+		if p.pr == pr {
+			p.HeadSHA, p.headSHA = shortSHA(sha), sha
+		}
+	}
+}
+
+// headSHAs returns the commits the PRs currently point to, where known.
+func (r *Report) headSHAs() []string {
+	shas := []string{}
+	for _, p := range r.pulls {
+		if p.headSHA != "" {
+			shas = append(shas, p.headSHA)
+		}
 	}
+	return shas
 }
 
 func (r *Report) Create(jobs map[string][]*internal.ProwJob) error {
 	if len(jobs) == 0 {
 		return fmt.Errorf("no jobs to create report")
 	}
+	all := []*internal.ProwJob{}
 	for _, v := range jobs {
 		for _, pj := range v {
-			currentVariant, ok := generated.Variants[pj.Name]
-			if !ok {
-				log.Printf("WARNING: Job %q does not have a known variant\n", pj.Name)
+			// The runs of aggregated jobs are shown through their aggregator.
+			if pj.AggregationID != "" && !pj.Aggregator {
 				continue
 			}
+			all = append(all, pj)
+		}
+	}
 
-			if e, ok := r.matrix[currentVariant.Name]; !ok {
-				// Matrix doesn't have this variant yet: just add it
-				r.matrix[currentVariant.Name] = newEntry(&currentVariant, pj)
-
-			} else {
-				// Entry already exists in matrix, just update it with the PASSING jobs
-				r.matrix[currentVariant.Name] = updateEntry(&e, &currentVariant, pj)
+	r.excluded = 0
+	unknown := sets.NewString()
+	inferred := map[string]variants.Definition{}
+	for _, v := range r.versions {
+		versionJobs := []*internal.ProwJob{}
+		current := []*internal.ProwJob{}
+		for _, pj := range all {
+			if pj.Version != v.Version {
+				continue
 			}
+			versionJobs = append(versionJobs, pj)
+			if pj.Outdated && r.outdated == OutdatedExclude {
+				r.excluded++
+				continue
+			}
+			current = append(current, pj)
+		}
+
+		matrix, names, guesses := buildMatrix(current, r.variants, r.outdated != OutdatedInclude)
+		unknown.Insert(names...)
+		for _, d := range guesses {
+			inferred[d.Job] = d
+		}
+		v.Data = matrix
+
+		if r.history {
+			v.History = buildHistory(versionJobs, r.headSHAs(), r.variants)
 		}
 	}
+	for _, name := range unknown.List() {
+		log.Printf("WARNING: Job %q does not have a known variant\n", name)
+	}
+	for _, name := range sets.StringKeySet(inferred).List() {
+		log.Printf("WARNING: Job %q does not have a known variant, inferred %q from its name\n", name, inferred[name].Variants)
+	}
+	if len(inferred) > 0 {
+		log.Printf("Run 'testgrid infer-variants' with the names of these jobs to get their definitions for review\n")
+	}
 	return nil
 }
 
+// buildMatrix aggregates the given jobs into a matrix indexed by variant name.
+// The variants of the jobs without a known one are inferred from their names,
+// and returned as well. It also returns the names of the jobs whose variant
+// couldn't be inferred either. Unless markOutdated is set, outdated runs are
+// treated like any other.
+func buildMatrix(jobs []*internal.ProwJob, known *variants.Set, markOutdated bool) (map[string]internal.Entry, []string, []variants.Definition) {
+	matrix := make(map[string]internal.Entry, 128)
+	unknown := sets.NewString()
+	inferred := []variants.Definition{}
+	for _, pj := range jobs {
+		if pj.Outdated && !markOutdated {
+			current := *pj
+			current.Outdated = false
+			pj = &current
+		}
+		version, _ := internal.ParseVersion(pj.Version)
+		currentVariant, ok := known.Lookup(pj.Name, version)
+		guessed := false
+		if !ok {
+			def, found := variants.Infer(pj.Name)
+			v, err := def.Variant()
+			if !found || err != nil {
+				unknown.Insert(pj.Name)
+				continue
+			}
+			currentVariant, guessed = v, true
+			inferred = append(inferred, def)
+		}
+
+		if e, ok := matrix[currentVariant.Name]; !ok {
+			// Matrix doesn't have this variant yet: just add it
+			matrix[currentVariant.Name] = newEntry(&currentVariant, pj)
+
+		} else {
+			// Entry already exists in matrix, just update it with the PASSING jobs
+			matrix[currentVariant.Name] = updateEntry(&e, &currentVariant, pj)
+		}
+		if guessed {
+			e := matrix[currentVariant.Name]
+			e.Inferred = true
+			matrix[currentVariant.Name] = e
+		}
+	}
+	return matrix, unknown.List(), inferred
+}
+
+// AddProblems lists issues found while crawling in the report, so readers know
+// which cells may be missing data.
+func (r *Report) AddProblems(problems []internal.CrawlProblem) {
+	r.problems = append(r.problems, problems...)
+}
+
+// WriteToFile renders the report into file. The file is replaced atomically,
+// so it can be kept open in a browser while the report is being updated.
 func (r *Report) WriteToFile(file string) error {
-	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
 	if err != nil {
 		return fmt.Errorf("failed to open report file: %w", err)
 	}
+	defer os.Remove(f.Name())
 	defer f.Close()
 
 	data := struct {
-		Title       string
-		URL         string
-		GeneratedOn time.Time
-		Data        any
+		PullRequests []*pullRequest
+		GeneratedOn  time.Time
+		Versions     []*versionMatrix
+		Problems     []internal.CrawlProblem
+		Excluded     int
 	}{
-		Title:       r.title,
-		URL:         r.url,
-		GeneratedOn: time.Now().UTC(),
-		Data:        r.matrix,
+		PullRequests: r.pulls,
+		GeneratedOn:  time.Now().UTC(),
+		Versions:     r.versions,
+		Problems:     r.problems,
+		Excluded:     r.excluded,
 	}
 	err = r.tmpl.ExecuteTemplate(f, "matrix", data)
 	if err != nil {
 		return fmt.Errorf("failed to execute template 'matrix': %w", err)
 	}
+	if err := f.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to set report file permissions: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return fmt.Errorf("failed to replace report file: %w", err)
+	}
 	return nil
 }
 
+// columns are the names of the matrix columns, in the same order as internal.Entry.Cells.
+var columns = []string{"Install Status", "Upgrade from current", "Upgrade from previous", "Serial", "Parallel", "CSI"}
+
+// Changes describes the cells of the main matrices whose state differs
+// between the old and new reports, e.g. "aws,amd64,ovn,ha / Serial: pending -> success".
+// The version is mentioned too when the report has more than one.
+func Changes(old, new *Report) []string {
+	changes := []string{}
+	for _, v := range new.versions {
+		prefix := ""
+		if len(new.versions) > 1 {
+			prefix = v.Version + " / "
+		}
+		prevData := map[string]internal.Entry{}
+		for _, o := range old.versions {
+			if o.Version == v.Version {
+				prevData = o.Data
+			}
+		}
+		changes = append(changes, matrixChanges(prefix, prevData, v.Data)...)
+	}
+	return changes
+}
+
+// matrixChanges describes the cells whose state differs between two matrices.
+func matrixChanges(prefix string, old, new map[string]internal.Entry) []string {
+	changes := []string{}
+	for _, variant := range sortedKeys(new) {
+		e := new[variant]
+		prev := old[variant]
+		prevCells := prev.Cells()
+		for i, c := range e.Cells() {
+			before, after := prevCells[i].Result, c.Result
+			if before == after {
+				continue
+			}
+			if before == "" {
+				before = "no data"
+			}
+			if after == "" {
+				after = "no data"
+			}
+			changes = append(changes, fmt.Sprintf("%s%s / %s: %s -> %s", prefix, variant, columns[i], before, after))
+		}
+	}
+	return changes
+}
+
+func sortedKeys(m map[string]internal.Entry) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func updateEntry(e *internal.Entry, v *internal.Variant, p *internal.ProwJob) internal.Entry {
 	newEntry := *e
-	c := internal.Cell{URL: p.URL, Result: p.Result}
-	if e.InstallSuccess.Result != "success" && p.InstallStatus == "success" {
-		newEntry.InstallSuccess = internal.Cell{URL: p.InstallStatusURL, Result: p.InstallStatus}
+	c := resultCell(p)
+	if preferCell(e.InstallSuccess, installCell(p)) {
+		newEntry.InstallSuccess = installCell(p)
 	}
 	if v.Parallel {
-		if e.Parallel.Result != "success" && p.Result == "success" {
+		if preferCell(e.Parallel, c) {
 			newEntry.Parallel = c
 		}
 	}
 	if v.Serial {
-		if e.Serial.Result != "success" && p.Result == "success" {
+		if preferCell(e.Serial, c) {
 			newEntry.Serial = c
 		}
 	}
 	if v.CSI {
-		if e.CSI.Result != "success" && p.Result == "success" {
+		if preferCell(e.CSI, c) {
 			newEntry.CSI = c
 		}
 	}
 	if v.UpgradeFromCurrent {
-		if e.UpgradeFromCurrent.Result != "success" && p.Result == "success" {
+		if preferCell(e.UpgradeFromCurrent, c) {
 			newEntry.UpgradeFromCurrent = c
 		}
 	}
 	if v.UpgradeFromPrevious {
-		if e.UpgradeFromPrevious.Result != "success" && p.Result == "success" {
+		if preferCell(e.UpgradeFromPrevious, c) {
 			newEntry.UpgradeFromPrevious = c
 		}
 	}
 	return newEntry
 }
 
+// preferCell tells whether the candidate cell should replace the current one.
+// Results for the head commit of the PR beat results for outdated commits.
+// Then, a passing run always wins; otherwise a finished run beats a pending
+// one, and any of them beats a missing result.
+func preferCell(current, candidate internal.Cell) bool {
+	rank := func(c internal.Cell) []bool {
+		finished := c.Result != "" && c.Result != internal.Pending
+		return []bool{c.Result != "" && !c.Outdated, c.Result == "success", finished, c.Result != ""}
+	}
+	cur, cand := rank(current), rank(candidate)
+	for i := range cur {
+		if cur[i] != cand[i] {
+			return cand[i]
+		}
+	}
+	return false
+}
+
+func resultCell(p *internal.ProwJob) internal.Cell {
+	return internal.Cell{URL: p.URL, Result: p.Result, Error: p.ResultFetchError, Tests: p.Tests, Aggregation: p.Aggregation, Outdated: p.Outdated, Job: p}
+}
+
+func installCell(p *internal.ProwJob) internal.Cell {
+	url := p.InstallStatusURL
+	if url == "" {
+		// We don't know where the install status is yet, e.g. the job is still running.
+		url = p.URL
+	}
+	return internal.Cell{URL: url, Result: p.InstallStatus, Error: p.InstallStatusFetchError, Source: p.InstallSource, InstallFailure: p.InstallFailure, Outdated: p.Outdated, Job: p}
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
 func newEntry(v *internal.Variant, p *internal.ProwJob) internal.Entry {
-	c := internal.Cell{URL: p.URL, Result: p.Result}
+	c := resultCell(p)
 	e := internal.Entry{Variant: v.Name}
-	e.InstallSuccess = internal.Cell{URL: p.InstallStatusURL, Result: p.InstallStatus}
+	e.InstallSuccess = installCell(p)
 	if v.Parallel {
 		e.Parallel = c
 	}
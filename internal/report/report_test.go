@@ -0,0 +1,66 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/bertinatto/testgrid/internal"
+	"github.com/bertinatto/testgrid/internal/variants"
+)
+
+const testJob = "periodic-ci-openshift-release-master-ci-4.15-e2e-aws-ovn"
+
+func testVariants() *variants.Set {
+	return variants.NewSet(map[string]internal.Variant{
+		testJob: {Name: "aws,amd64,ovn,ha", Parallel: true},
+	})
+}
+
+func TestOutdatedRuns(t *testing.T) {
+	jobs := map[string][]*internal.ProwJob{testJob: {
+		{Name: testJob, URL: "https://example.com/1", Version: "4.15", Result: "success", PRHeadSHA: "old", Outdated: true},
+		{Name: testJob, URL: "https://example.com/2", Version: "4.15", Result: "failure", PRHeadSHA: "new"},
+	}}
+
+	for _, tc := range []struct {
+		mode         string
+		wantURL      string
+		wantOutdated bool
+	}{
+		// The head commit failed, which beats the outdated success.
+		{OutdatedExclude, "https://example.com/2", false},
+		{OutdatedMark, "https://example.com/2", false},
+		// The success wins and isn't marked as outdated.
+		{OutdatedInclude, "https://example.com/1", false},
+	} {
+		v, _ := internal.ParseVersion("4.15")
+		r := New(internal.PullRequest{Org: "o", Repo: "r", Number: 1})
+		r.AddVersion(v)
+		r.variants = testVariants()
+		if err := r.SetOutdatedRuns(tc.mode); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := r.Create(jobs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cell := r.versions[0].Data["aws,amd64,ovn,ha"].Parallel
+		if cell.URL != tc.wantURL || cell.Outdated != tc.wantOutdated {
+			t.Errorf("%s: expected %s (outdated: %v), got %s (outdated: %v)", tc.mode, tc.wantURL, tc.wantOutdated, cell.URL, cell.Outdated)
+		}
+	}
+
+	// Outdated runs are only shown when there's nothing else.
+	jobs[testJob] = jobs[testJob][:1]
+	r := New(internal.PullRequest{Org: "o", Repo: "r", Number: 1})
+	v, _ := internal.ParseVersion("4.15")
+	r.AddVersion(v)
+	r.variants = testVariants()
+	if err := r.SetOutdatedRuns(OutdatedMark); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Create(jobs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cell := r.versions[0].Data["aws,amd64,ovn,ha"].Parallel; !cell.Outdated {
+		t.Errorf("expected the outdated run to be marked, got %+v", cell)
+	}
+}
@@ -1,5 +1,10 @@
 package internal
 
+import "time"
+
+// Pending is the result of jobs that haven't finished yet.
+const Pending = "pending"
+
 // ProwJob represents the result for a Prow job run.
 type ProwJob struct {
 	Name             string `json:"name"`
@@ -8,17 +13,155 @@ type ProwJob struct {
 	InstallStatus    string `json:"install_status"`
 	ResultURL        string `json:"result_file"`
 	Result           string `json:"result"`
+
+	// InstallSource tells which artifact the install status was taken from,
+	// e.g. "gather-must-gather/artifacts/install-status.txt".
+	InstallSource string `json:"install_source,omitempty"`
+	// InstallLogURLs are the artifacts that may explain why the install failed,
+	// i.e. junit_install.xml and the build logs of the install steps.
+	InstallLogURLs []string        `json:"install_log_files,omitempty"`
+	InstallFailure *InstallFailure `json:"install_failure,omitempty"`
+
+	// The fetch errors are set when the corresponding file could not be
+	// retrieved, as opposed to not existing at all.
+	InstallStatusFetchError string `json:"install_status_fetch_error,omitempty"`
+	ResultFetchError        string `json:"result_fetch_error,omitempty"`
+
+	JUnitURLs []string     `json:"junit_files,omitempty"`
+	Tests     *TestSummary `json:"tests,omitempty"`
+
+	// Metadata gathered from started.json, finished.json and prowjob.json.
+	BuildID      string    `json:"build_id,omitempty"`
+	StartTime    time.Time `json:"start_time,omitempty"`
+	FinishTime   time.Time `json:"finish_time,omitempty"`
+	PRHeadSHA    string    `json:"pr_head_sha,omitempty"`
+	ReleaseImage string    `json:"release_image,omitempty"`
+
+	// Version is the OCP version the job is for.
+	Version string `json:"version,omitempty"`
+
+	// State is the state of the job according to prow, e.g. "pending" or "success".
+	State string `json:"state,omitempty"`
+
+	// Outdated is set when the job tested a commit that is no longer the head of the PR.
+	Outdated bool `json:"outdated,omitempty"`
+
+	// AggregationID is shared by the runs of an aggregated payload job and
+	// their aggregator. Aggregator is only set for the latter, which also
+	// gets the Aggregation of the runs.
+	AggregationID string       `json:"aggregation_id,omitempty"`
+	Aggregator    bool         `json:"aggregator,omitempty"`
+	Aggregation   *Aggregation `json:"aggregation,omitempty"`
+}
+
+// Elapsed returns for how long a pending job has been running, or zero if it's not pending.
+func (p *ProwJob) Elapsed() time.Duration {
+	if p.Result != Pending || p.StartTime.IsZero() {
+		return 0
+	}
+	return time.Since(p.StartTime).Round(time.Minute)
+}
+
+// Duration returns how long the job took, or zero if it's not known.
+func (p *ProwJob) Duration() time.Duration {
+	if p.StartTime.IsZero() || p.FinishTime.IsZero() {
+		return 0
+	}
+	return p.FinishTime.Sub(p.StartTime)
+}
+
+// Install phases in which an install may fail.
+const (
+	PhaseConfiguration  = "configuration"
+	PhaseInfrastructure = "infrastructure provisioning"
+	PhaseBootstrap      = "bootstrap"
+	PhaseOperators      = "cluster operators not available"
+	PhaseCloudAPI       = "cloud quota/API"
+	PhaseOther          = "other"
+)
+
+// InstallFailure tells in which phase an install failed, and why.
+type InstallFailure struct {
+	Phase  string `json:"phase"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Aggregation counts how the runs of an aggregated payload job went.
+type Aggregation struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Pending int `json:"pending"`
+	// Verdict is the statistical verdict of the aggregator: "pass", "fail" or
+	// "pending". It is empty if the aggregator result is unknown.
+	Verdict string `json:"verdict,omitempty"`
+}
+
+// Total returns the number of runs of the aggregated job.
+func (a *Aggregation) Total() int {
+	return a.Passed + a.Failed + a.Pending
+}
+
+// TestSummary counts the test cases of a job run, as reported in its JUnit files.
+type TestSummary struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Flaked  int `json:"flaked"`
+	Skipped int `json:"skipped"`
+	// FailedTests are the names of the tests that failed, flakes excluded.
+	FailedTests []string `json:"failed_tests,omitempty"`
+}
+
+// Add accumulates the counts of another summary into s.
+func (s *TestSummary) Add(o *TestSummary) {
+	s.Passed += o.Passed
+	s.Failed += o.Failed
+	s.Flaked += o.Flaked
+	s.Skipped += o.Skipped
+	s.FailedTests = append(s.FailedTests, o.FailedTests...)
+}
+
+// Top returns at most n of the failed tests.
+func (s *TestSummary) Top(n int) []string {
+	if len(s.FailedTests) <= n {
+		return s.FailedTests
+	}
+	return s.FailedTests[:n]
+}
+
+// CrawlProblem is an issue found while crawling a single URL.
+type CrawlProblem struct {
+	URL     string
+	Message string
 }
 
 // Cell holds the information of a "td" in an HTML table.
 type Cell struct {
 	URL    string
 	Result string
+	// Error is set when the result is missing because it couldn't be fetched.
+	Error string
+	// Tests is set when the job produced JUnit results.
+	Tests *TestSummary
+	// Outdated is set when the result is for a commit that is no longer the head of the PR.
+	Outdated bool
+	// Previous is the result for the previous commit of the PR, when it was different.
+	Previous string
+	// Source tells where the result was taken from, when it's not obvious.
+	Source string
+	// InstallFailure explains a failed install, when it could be classified.
+	InstallFailure *InstallFailure
+	// Aggregation is set when the result is the verdict of an aggregated job.
+	Aggregation *Aggregation
+	// Job is the run shown in the cell, if any.
+	Job *ProwJob
 }
 
 // Entry is an "row" in the table data.
 type Entry struct {
-	Variant             string
+	Variant string
+	// Inferred is set when the variant of some of the jobs in the row was
+	// guessed from their names, as they are missing from the definitions.
+	Inferred            bool
 	InstallSuccess      Cell
 	OverallTest         bool
 	UpgradeFromCurrent  Cell
@@ -28,6 +171,11 @@ type Entry struct {
 	CSI                 Cell
 }
 
+// Cells returns pointers to all cells of the entry, in column order.
+func (e *Entry) Cells() []*Cell {
+	return []*Cell{&e.InstallSuccess, &e.UpgradeFromCurrent, &e.UpgradeFromPrevious, &e.Serial, &e.Parallel, &e.CSI}
+}
+
 // Variant is a set of prow jobs that test similar characteristics of an OCP installation.
 type Variant struct {
 	Name                string
@@ -0,0 +1,137 @@
+package variants
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tokens of job names that tell the dimensions of a variant. The first match
+// in each list wins, so more specific tokens go first.
+var (
+	platformTokens = []string{"aws", "azure", "gcp", "vsphere", "metal", "openstack", "ovirt", "nutanix", "ibmcloud", "alibaba", "powervs", "libvirt", "kubevirt", "agent"}
+	archTokens     = map[string]string{"arm64": "arm64", "aarch64": "arm64", "ppc64le": "ppc64le", "s390x": "s390x", "multi": "multi", "heterogeneous": "multi"}
+	// featureTokens are shown in the variant name after the topology, in
+	// this order, e.g. "aws,amd64,ovn,ha,techpreview".
+	featureTokens = []string{"techpreview", "hypershift", "osd", "rosa", "fips", "proxy", "realtime"}
+)
+
+// versionTokenRe matches the OCP version in job names, e.g. "4.16".
+var versionTokenRe = regexp.MustCompile(`^\d+\.\d+$`)
+
+// Infer guesses the variant of a job from the tokens of its name, e.g.
+// periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn-serial is
+// "aws,amd64,ovn,ha,serial". Defaults are assumed for what the name doesn't
+// tell: amd64, OVN-Kubernetes and a highly available control plane. It
+// returns false if no platform can be told from the name, which is the case
+// of jobs that don't install a cluster.
+func Infer(job string) (Definition, bool) {
+	tokens := strings.Split(strings.ToLower(job), "-")
+	has := map[string]bool{}
+	upgrade := ""
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t == "upgrade" && i+3 < len(tokens) && tokens[i+1] == "from" && tokens[i+2] == "stable" && versionTokenRe.MatchString(tokens[i+3]):
+			// e.g. upgrade-from-stable-4.15, which is the previous release.
+			upgrade = "upgrade-minor"
+			i += 3
+		case t == "upgrade" && upgrade == "":
+			upgrade = "upgrade-micro"
+		case t == "rt":
+			has["realtime"] = true
+		case t == "sno":
+			has["single-node"] = true
+		case t == "single" && i+1 < len(tokens) && tokens[i+1] == "node":
+			has["single-node"] = true
+			i++
+		case t == "tech" && i+1 < len(tokens) && tokens[i+1] == "preview":
+			has["techpreview"] = true
+			i++
+		default:
+			has[t] = true
+		}
+	}
+
+	platform := ""
+	for _, p := range platformTokens {
+		if has[p] {
+			platform = p
+			break
+		}
+	}
+	if platform == "" && (has["rosa"] || has["hypershift"]) {
+		// ROSA and HyperShift jobs that don't mention the platform run on AWS.
+		platform = "aws"
+	}
+	if platform == "" {
+		return Definition{}, false
+	}
+	// Extended variants that tell how bare metal clusters were installed, e.g. "metal,ipi".
+	install := []string{}
+	if platform == "metal" || platform == "vsphere" {
+		method := "ipi"
+		switch {
+		case has["upi"]:
+			method = "upi"
+		case has["assisted"] || has["live"] && has["iso"]:
+			method = "assisted"
+		}
+		if platform == "metal" {
+			install = []string{platform, method}
+		}
+		platform += "-" + method
+	}
+
+	arch := "amd64"
+	for _, t := range tokens {
+		if a, ok := archTokens[t]; ok {
+			arch = a
+			break
+		}
+	}
+	network := "ovn"
+	if has["sdn"] {
+		network = "sdn"
+	}
+	topology := "ha"
+	if has["single-node"] {
+		topology = "single-node"
+	}
+
+	names := []string{platform, arch, network}
+	if upgrade != "" {
+		names = append(names, upgrade)
+	}
+	names = append(names, topology)
+	if has["serial"] {
+		names = append(names, "serial")
+	}
+	for _, f := range featureTokens {
+		if has[f] {
+			names = append(names, f)
+		}
+	}
+
+	// Jobs run the parallel suite unless they say otherwise, and may run
+	// more suites on top of it.
+	extended := append([]string{}, names...)
+	if !has["serial"] {
+		extended = append(extended, "parallel")
+	}
+	if has["csi"] {
+		extended = append(extended, "csi")
+	}
+	if has["ipv6"] {
+		extended = append(extended, "ipv6")
+	}
+	if has["realtime"] {
+		extended = append(extended, "rt")
+	}
+	extended = append(extended, install...)
+
+	return Definition{
+		Job:              job,
+		Variants:         strings.Join(names, ","),
+		ExtendedVariants: strings.Join(extended, ","),
+	}, true
+}
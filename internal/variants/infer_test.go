@@ -0,0 +1,82 @@
+package variants
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInfer(t *testing.T) {
+	for _, tc := range []struct {
+		job      string
+		variants string
+		extended string
+	}{
+		{
+			job:      "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn-serial",
+			variants: "aws,amd64,ovn,ha,serial",
+			extended: "aws,amd64,ovn,ha,serial",
+		},
+		{
+			job:      "periodic-ci-openshift-release-master-ci-4.16-upgrade-from-stable-4.15-e2e-gcp-sdn-upgrade",
+			variants: "gcp,amd64,sdn,upgrade-minor,ha",
+			extended: "gcp,amd64,sdn,upgrade-minor,ha,parallel",
+		},
+		{
+			job:      "periodic-ci-openshift-release-master-nightly-4.16-e2e-metal-ipi-sdn-bm-upgrade",
+			variants: "metal-ipi,amd64,sdn,upgrade-micro,ha",
+			extended: "metal-ipi,amd64,sdn,upgrade-micro,ha,parallel,metal,ipi",
+		},
+		{
+			job:      "periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn-single-node-tech-preview",
+			variants: "aws,amd64,ovn,single-node,techpreview",
+			extended: "aws,amd64,ovn,single-node,techpreview,parallel",
+		},
+		{
+			job:      "periodic-ci-openshift-multiarch-master-nightly-4.16-ocp-e2e-azure-ovn-arm64-csi",
+			variants: "azure,arm64,ovn,ha",
+			extended: "azure,arm64,ovn,ha,parallel,csi",
+		},
+		{
+			job:      "periodic-ci-openshift-release-master-nightly-4.16-e2e-gcp-ovn-rt",
+			variants: "gcp,amd64,ovn,ha,realtime",
+			extended: "gcp,amd64,ovn,ha,realtime,parallel,rt",
+		},
+		{
+			job:      "periodic-ci-openshift-hypershift-release-4.16-periodics-e2e-conformance",
+			variants: "aws,amd64,ovn,ha,hypershift",
+			extended: "aws,amd64,ovn,ha,hypershift,parallel",
+		},
+	} {
+		d, ok := Infer(tc.job)
+		if !ok {
+			t.Errorf("Infer(%q) failed", tc.job)
+			continue
+		}
+		if d.Job != tc.job || d.Variants != tc.variants || d.ExtendedVariants != tc.extended {
+			t.Errorf("Infer(%q) = %q, %q, expected %q, %q", tc.job, d.Variants, d.ExtendedVariants, tc.variants, tc.extended)
+		}
+		if _, err := d.Variant(); err != nil {
+			t.Errorf("Infer(%q) returned an invalid definition: %v", tc.job, err)
+		}
+	}
+
+	if d, ok := Infer("pull-ci-openshift-origin-master-unit"); ok {
+		t.Errorf("expected no variant for a job that doesn't install a cluster, got %+v", d)
+	}
+}
+
+func TestWriteTSV(t *testing.T) {
+	d, _ := Infer("periodic-ci-openshift-release-master-nightly-4.16-e2e-aws-ovn-serial")
+	var buf strings.Builder
+	if err := WriteTSV(&buf, []Definition{d}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The lines can be appended to a file with a header.
+	defs, err := ParseTSV(strings.NewReader("Prow Job\tVariants\tExtended Variants\n" + buf.String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(defs) != 1 || defs[0] != d {
+		t.Errorf("expected %+v, got %+v", d, defs)
+	}
+}
@@ -0,0 +1,149 @@
+package variants
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dimensions of variants and the tokens known for each of them. Tokens that
+// are only used in extended variants are in the "extended" dimension.
+var dimensionTokens = map[string][]string{
+	"platform": {"aws", "azure", "gcp", "vsphere-ipi", "vsphere-upi", "metal-ipi", "metal-upi", "metal-assisted", "openstack", "ovirt", "nutanix", "ibmcloud", "alibaba", "powervs", "libvirt", "kubevirt", "agent"},
+	"arch":     {"amd64", "arm64", "ppc64le", "s390x", "multi"},
+	"network":  {"ovn", "sdn"},
+	"topology": {"ha", "single-node"},
+	"upgrade":  {"upgrade-micro", "upgrade-minor"},
+	"suite":    {"parallel", "serial", "csi"},
+	"feature":  {"techpreview", "hypershift", "osd", "rosa", "fips", "proxy", "realtime", "assisted"},
+	"extended": {"metal", "vsphere", "ipi", "upi", "rt", "ipv6", "cpmso", "console"},
+}
+
+// exclusiveDimensions can't have more than one token in a variant.
+var exclusiveDimensions = []string{"platform", "arch", "network", "topology", "upgrade"}
+
+// LintProblem is an issue found in a line of a TSV file of definitions.
+type LintProblem struct {
+	Line    int
+	Message string
+}
+
+// Lint checks a TSV document of definitions, like the one read by ParseTSV,
+// for mistakes that would otherwise go unnoticed: wrong column counts, stray
+// whitespace, unknown or conflicting tokens, duplicate jobs and extended
+// variants that aren't a superset of the variants. Problems are returned in
+// line order; an error is only returned if the document can't be read.
+func Lint(r io.Reader) ([]LintProblem, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	// Column counts are checked below, so they can be reported with the others.
+	reader.FieldsPerRecord = -1
+
+	problems := []LintProblem{}
+	add := func(line int, format string, args ...interface{}) {
+		problems = append(problems, LintProblem{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	dimensions := map[string]string{}
+	for dim, tokens := range dimensionTokens {
+		for _, t := range tokens {
+			dimensions[t] = dim
+		}
+	}
+
+	seen := map[string]int{}
+	for header := true; ; header = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != 3 {
+			add(line, "expected 3 columns, found %d", len(record))
+			continue
+		}
+		if header {
+			continue
+		}
+
+		d := Definition{Job: record[0], Variants: record[1], ExtendedVariants: record[2]}
+		if d.Job == "" {
+			add(line, "empty job")
+			continue
+		}
+		if strings.TrimSpace(d.Job) != d.Job {
+			add(line, "leading or trailing whitespace in job %q", d.Job)
+		}
+		if first, ok := seen[d.Job]; ok {
+			add(line, "duplicate job %q, first defined on line %d", d.Job, first)
+		} else {
+			seen[d.Job] = line
+		}
+		if err := checkPattern(d.Job); err != nil {
+			add(line, "%v", err)
+		}
+
+		variants := lintTokens(line, "variants", d.Variants, dimensions, add)
+		extended := lintTokens(line, "extended variants", d.ExtendedVariants, dimensions, add)
+		for _, t := range variants {
+			if !contains(extended, t) {
+				add(line, "variant %q is missing from the extended variants", t)
+			}
+		}
+		for _, t := range variants {
+			if dimensions[t] == "extended" {
+				add(line, "%q is only valid in the extended variants", t)
+			}
+		}
+
+		// Check for conflicts in the extended variants, which are what the
+		// matrix is built from.
+		byDimension := map[string][]string{}
+		for _, t := range extended {
+			if dim, ok := dimensions[t]; ok && !contains(byDimension[dim], t) {
+				byDimension[dim] = append(byDimension[dim], t)
+			}
+		}
+		for _, dim := range exclusiveDimensions {
+			if len(byDimension[dim]) > 1 {
+				add(line, "conflicting %s tokens: %s", dim, strings.Join(byDimension[dim], ", "))
+			}
+		}
+		if contains(extended, "serial") && contains(extended, "parallel") {
+			add(line, "conflicting suites: serial, parallel")
+		}
+	}
+	return problems, nil
+}
+
+// lintTokens checks the comma-separated tokens of a column and returns them.
+func lintTokens(line int, column, value string, dimensions map[string]string, add func(int, string, ...interface{})) []string {
+	if value == "" {
+		add(line, "empty %s", column)
+		return nil
+	}
+	tokens := []string{}
+	for _, t := range strings.Split(value, ",") {
+		switch {
+		case t == "":
+			add(line, "empty token in %s %q", column, value)
+			continue
+		case strings.TrimSpace(t) != t:
+			add(line, "whitespace around token %q in %s", t, column)
+			t = strings.TrimSpace(t)
+		}
+		if _, ok := dimensions[t]; !ok {
+			add(line, "unknown token %q in %s", t, column)
+		}
+		if contains(tokens, t) {
+			add(line, "repeated token %q in %s", t, column)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
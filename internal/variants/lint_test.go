@@ -0,0 +1,85 @@
+package variants
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	input := strings.Join([]string{
+		"Prow Job\tVariants\tExtended Variants",
+		"job-1\taws,amd64,ovn,ha\taws,amd64,ovn,ha,parallel",
+		"job-2\taws,amd64",
+		"job-1\taws,amd64,ovn,ha\taws,amd64,ovn,ha,parallel",
+		"job-3\taws,amd64,ovn,ha \taws,amd64,ovn,upgrade-micro,upgrade-minor,ha,serial,parallel",
+		"job-4\tgcp,x86,ovn,ha\tgcp,ovn,ha,,parallel",
+		"/job-[/\taws,amd64,ovn,ha\taws,amd64,ovn,ha,parallel",
+		"job-5\t\taws,amd64,ovn,ha,parallel",
+		"",
+	}, "\n")
+
+	problems, err := Lint(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []LintProblem{
+		{3, "expected 3 columns, found 2"},
+		{4, `duplicate job "job-1", first defined on line 2`},
+		{5, `whitespace around token "ha " in variants`},
+		{5, "conflicting upgrade tokens: upgrade-micro, upgrade-minor"},
+		{5, "conflicting suites: serial, parallel"},
+		{6, `unknown token "x86" in variants`},
+		{6, `empty token in extended variants "gcp,ovn,ha,,parallel"`},
+		{6, `variant "x86" is missing from the extended variants`},
+		{7, "invalid job pattern \"/job-[/\": error parsing regexp: missing closing ]: `[`"},
+		{8, "empty variants"},
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("unexpected problems:\n%v\nexpected:\n%v", problems, want)
+	}
+}
+
+func TestLintValid(t *testing.T) {
+	input := "Prow Job\tVariants\tExtended Variants\n" +
+		"ci-{version}-upgrade-from-stable-{previous}-e2e-aws-ovn-upgrade\taws,amd64,ovn,upgrade-minor,ha\taws,amd64,ovn,upgrade-minor,ha,parallel\n" +
+		"nightly-4.16-e2e-metal-ipi-ovn\tmetal-ipi,amd64,ovn,ha\tmetal-ipi,amd64,ovn,ha,parallel,metal,ipi\n"
+	problems, err := Lint(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+// TestLintInfer checks that the variants inferred from job names pass the lint.
+func TestLintInfer(t *testing.T) {
+	data, err := os.ReadFile("../../variants/input.tsv")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defs, err := ParseTSV(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inferred := []Definition{}
+	for _, d := range defs {
+		if i, ok := Infer(d.Job); ok {
+			inferred = append(inferred, i)
+		}
+	}
+	var buf strings.Builder
+	buf.WriteString("Prow Job\tVariants\tExtended Variants\n")
+	if err := WriteTSV(&buf, inferred); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	problems, err := Lint(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
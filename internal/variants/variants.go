@@ -0,0 +1,313 @@
+// Package variants maps prow jobs to the variants they test, i.e. the rows
+// of the matrix and the columns their results go to.
+package variants
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bertinatto/testgrid/internal"
+	"sigs.k8s.io/yaml"
+)
+
+// Definition tells the variant of a job, in the same terms as the columns of
+// variants/input.tsv.
+type Definition struct {
+	// Job is the name of the prow job. It may be a template in which
+	// {version} and {previous} stand for the OCP version being crawled and
+	// the one before, e.g. periodic-ci-openshift-release-master-nightly-{version}-e2e-aws-ovn,
+	// or a regular expression between slashes, which may use the same placeholders.
+	Job string `json:"job"`
+	// Variants is the name of the variant, e.g. "aws,amd64,ovn,ha".
+	Variants string `json:"variants"`
+	// ExtendedVariants are the variants plus the suites the job runs, e.g.
+	// "aws,amd64,ovn,ha,serial" or "aws,amd64,ovn,ha,upgrade-minor".
+	ExtendedVariants string `json:"extended_variants"`
+}
+
+// Variant converts the definition into the variant used to build the matrix.
+func (d Definition) Variant() (internal.Variant, error) {
+	extended := strings.Split(d.ExtendedVariants, ",")
+	upgradeFromCurrent := contains(extended, "upgrade-micro")
+	upgradeFromPrevious := contains(extended, "upgrade-minor")
+	if upgradeFromCurrent && upgradeFromPrevious {
+		return internal.Variant{}, fmt.Errorf("job %q contains both upgrade-micro and upgrade-minor", d.Job)
+	}
+	return internal.Variant{
+		Name:                d.Variants,
+		Parallel:            contains(extended, "parallel"),
+		CSI:                 contains(extended, "csi"),
+		UpgradeFromCurrent:  upgradeFromCurrent,
+		UpgradeFromPrevious: upgradeFromPrevious,
+		Serial:              contains(extended, "serial"),
+	}, nil
+}
+
+// Placeholders that may be used in job name templates.
+const (
+	VersionPlaceholder  = "{version}"
+	PreviousPlaceholder = "{previous}"
+)
+
+// IsPattern tells whether the job name is a template or a regular expression
+// rather than the name of a single job.
+func (d Definition) IsPattern() bool {
+	return isRegexp(d.Job) || strings.Contains(d.Job, VersionPlaceholder) || strings.Contains(d.Job, PreviousPlaceholder)
+}
+
+func isRegexp(job string) bool {
+	return len(job) > 1 && strings.HasPrefix(job, "/") && strings.HasSuffix(job, "/")
+}
+
+// pattern is a definition whose job name is a template or a regular expression.
+type pattern struct {
+	job     string
+	variant internal.Variant
+	// order tells when the pattern was defined, see Set.
+	order int
+
+	mu sync.Mutex
+	// compiled caches the expression for each version.
+	compiled map[internal.Version]*regexp.Regexp
+}
+
+// regexp returns the expression matching the names of the jobs of the given
+// version, or nil if the pattern can't be resolved for it.
+func (p *pattern) regexp(version internal.Version) *regexp.Regexp {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if re, ok := p.compiled[version]; ok {
+		return re
+	}
+
+	var re *regexp.Regexp
+	if expr, ok := p.expression(version); ok {
+		re, _ = regexp.Compile(expr)
+	}
+	if p.compiled == nil {
+		p.compiled = map[internal.Version]*regexp.Regexp{}
+	}
+	p.compiled[version] = re
+	return re
+}
+
+// expression resolves the placeholders of the pattern for the given version.
+func (p *pattern) expression(version internal.Version) (string, bool) {
+	if version == (internal.Version{}) {
+		return "", false
+	}
+	current := version.String()
+	previous := ""
+	if prev, ok := version.Previous(); ok {
+		previous = prev.String()
+	} else if strings.Contains(p.job, PreviousPlaceholder) {
+		return "", false
+	}
+
+	if isRegexp(p.job) {
+		r := strings.NewReplacer(VersionPlaceholder, regexp.QuoteMeta(current), PreviousPlaceholder, regexp.QuoteMeta(previous))
+		return r.Replace(p.job[1 : len(p.job)-1]), true
+	}
+	r := strings.NewReplacer(VersionPlaceholder, current, PreviousPlaceholder, previous)
+	return "^" + regexp.QuoteMeta(r.Replace(p.job)) + "$", true
+}
+
+// Set holds the variants of the known jobs. The zero value is an empty set.
+// The latest definition of a job wins, whether it names the job or matches it
+// with a pattern, so a template can override jobs defined before by name.
+type Set struct {
+	jobs map[string]namedJob
+	// patterns are sorted from the latest to the earliest defined.
+	patterns []*pattern
+	// defined is the number of definitions added so far.
+	defined int
+}
+
+// namedJob is the variant of a job defined by name.
+type namedJob struct {
+	variant internal.Variant
+	// order tells when the job was defined; the ones the set was created with come first.
+	order int
+}
+
+// NewSet creates a set with the given variants, indexed by job name.
+func NewSet(jobs map[string]internal.Variant) *Set {
+	s := &Set{jobs: make(map[string]namedJob, len(jobs))}
+	for name, v := range jobs {
+		s.jobs[name] = namedJob{variant: v}
+	}
+	return s
+}
+
+// Add adds the definitions to the set, replacing the variants of the jobs
+// that were already known.
+func (s *Set) Add(defs []Definition) error {
+	if s.jobs == nil {
+		s.jobs = make(map[string]namedJob, len(defs))
+	}
+	for _, d := range defs {
+		v, err := d.Variant()
+		if err != nil {
+			return err
+		}
+		s.defined++
+		if !d.IsPattern() {
+			s.jobs[d.Job] = namedJob{variant: v, order: s.defined}
+			continue
+		}
+		if err := checkPattern(d.Job); err != nil {
+			return err
+		}
+		// Later definitions override earlier ones, so they go first.
+		s.patterns = append([]*pattern{{job: d.Job, variant: v, order: s.defined}}, s.patterns...)
+	}
+	return nil
+}
+
+// checkPattern checks the job name is a valid expression, if it's a regular
+// expression, whatever the version.
+func checkPattern(job string) error {
+	if !isRegexp(job) {
+		return nil
+	}
+	if _, err := regexp.Compile(strings.NewReplacer(VersionPlaceholder, "4.0", PreviousPlaceholder, "3.11").Replace(job[1 : len(job)-1])); err != nil {
+		return fmt.Errorf("invalid job pattern %q: %w", job, err)
+	}
+	return nil
+}
+
+// Lookup returns the variant of a job of the given OCP version, if known.
+// The job name is matched against patterns, whose placeholders are replaced
+// according to the version, as well as names; the latest definition wins.
+func (s *Set) Lookup(name string, version internal.Version) (internal.Variant, bool) {
+	if s == nil {
+		return internal.Variant{}, false
+	}
+	exact, found := s.jobs[name]
+	for _, p := range s.patterns {
+		if found && p.order < exact.order {
+			// The remaining patterns were defined before the name.
+			break
+		}
+		if re := p.regexp(version); re != nil && re.MatchString(name) {
+			return p.variant, true
+		}
+	}
+	return exact.variant, found
+}
+
+// Jobs returns the variants of the jobs defined by name, indexed by job name.
+// Patterns are left out.
+func (s *Set) Jobs() map[string]internal.Variant {
+	jobs := make(map[string]internal.Variant, len(s.jobs))
+	for name, j := range s.jobs {
+		jobs[name] = j.variant
+	}
+	return jobs
+}
+
+// Fallback returns a set that looks jobs up in s first, then in fallback.
+func (s *Set) Fallback(fallback map[string]internal.Variant) *Set {
+	merged := NewSet(fallback)
+	for name, j := range s.jobs {
+		merged.jobs[name] = j
+	}
+	merged.patterns = s.patterns
+	merged.defined = s.defined
+	return merged
+}
+
+// LoadFile reads definitions from a TSV, YAML or JSON file, depending on its extension.
+func LoadFile(file string) ([]Definition, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defs, err := Parse(filepath.Ext(file), data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %q: %w", file, err)
+	}
+	return defs, nil
+}
+
+// Parse reads definitions in the format given by the file extension: ".tsv",
+// ".yaml", ".yml" or ".json". YAML and JSON files hold a list of definitions.
+func Parse(ext string, data []byte) ([]Definition, error) {
+	switch strings.ToLower(ext) {
+	case ".tsv":
+		return ParseTSV(bytes.NewReader(data))
+	case ".yaml", ".yml":
+		var defs []Definition
+		if err := yaml.UnmarshalStrict(data, &defs); err != nil {
+			return nil, err
+		}
+		return defs, nil
+	case ".json":
+		var defs []Definition
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&defs); err != nil {
+			return nil, err
+		}
+		return defs, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected .tsv, .yaml, .yml or .json", ext)
+}
+
+// ParseTSV reads definitions from a TSV document with a header line and the
+// job, variants and extended variants columns.
+func ParseTSV(r io.Reader) ([]Definition, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) < 1 {
+		return nil, fmt.Errorf("invalid TSV file: not enough records")
+	}
+	if len(records[0]) < 3 {
+		return nil, fmt.Errorf("invalid TSV file: expected 3 columns, found %d", len(records[0]))
+	}
+
+	// Start from index 1 to discard headers
+	defs := make([]Definition, 0, len(records)-1)
+	for i := 1; i < len(records); i++ {
+		line := records[i]
+		defs = append(defs, Definition{Job: line[0], Variants: line[1], ExtendedVariants: line[2]})
+	}
+	return defs, nil
+}
+
+// WriteTSV writes the definitions as lines in the format read by ParseTSV,
+// without the header line, so they can be appended to a TSV file.
+func WriteTSV(w io.Writer, defs []Definition) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+	for _, d := range defs {
+		if err := writer.Write([]string{d.Job, d.Variants, d.ExtendedVariants}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func contains(slice []string, target string) bool {
+	for _, s := range slice {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
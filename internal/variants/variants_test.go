@@ -0,0 +1,71 @@
+package variants
+
+import (
+	"testing"
+
+	"github.com/bertinatto/testgrid/internal"
+)
+
+func TestLookupOrder(t *testing.T) {
+	s := &Set{}
+	for _, defs := range [][]Definition{
+		// e.g. the built-in definitions...
+		{
+			{Job: "ci-4.15-e2e-aws", Variants: "builtin", ExtendedVariants: "builtin,parallel"},
+			{Job: "ci-4.16-e2e-aws", Variants: "builtin", ExtendedVariants: "builtin,parallel"},
+		},
+		// ...overridden by a template passed with -variants...
+		{{Job: "ci-{version}-e2e-aws", Variants: "template", ExtendedVariants: "template,serial"}},
+		// ...which is overridden in turn for a single job.
+		{{Job: "ci-4.16-e2e-aws", Variants: "override", ExtendedVariants: "override,serial"}},
+	} {
+		if err := s.Add(defs); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	merged := s.Fallback(map[string]internal.Variant{
+		"ci-4.17-e2e-aws": {Name: "generated"},
+		"ci-4.18-e2e-gcp": {Name: "generated"},
+	})
+
+	for _, tc := range []struct {
+		version string
+		job     string
+		want    string
+	}{
+		{"4.15", "ci-4.15-e2e-aws", "template"},
+		{"4.16", "ci-4.16-e2e-aws", "override"},
+		{"4.17", "ci-4.17-e2e-aws", "template"},
+		{"4.18", "ci-4.18-e2e-gcp", "generated"},
+		{"4.18", "ci-4.18-e2e-azure", ""},
+	} {
+		v, _ := internal.ParseVersion(tc.version)
+		got, ok := merged.Lookup(tc.job, v)
+		if tc.want == "" {
+			if ok {
+				t.Errorf("Lookup(%q) = %q, expected none", tc.job, got.Name)
+			}
+			continue
+		}
+		if !ok || got.Name != tc.want {
+			t.Errorf("Lookup(%q) = %q, %v, expected %q", tc.job, got.Name, ok, tc.want)
+		}
+	}
+}
+
+func TestLookupRegexp(t *testing.T) {
+	s := &Set{}
+	if err := s.Add([]Definition{{Job: `/^ci-{version}-upgrade-from-stable-{previous}-e2e-(aws|gcp)-ovn-upgrade$/`, Variants: "upgrade", ExtendedVariants: "upgrade,upgrade-minor"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v, _ := internal.ParseVersion("4.16")
+	if got, ok := s.Lookup("ci-4.16-upgrade-from-stable-4.15-e2e-gcp-ovn-upgrade", v); !ok || !got.UpgradeFromPrevious {
+		t.Errorf("expected the job to match, got %+v, %v", got, ok)
+	}
+	if _, ok := s.Lookup("ci-4.16-upgrade-from-stable-4.14-e2e-gcp-ovn-upgrade", v); ok {
+		t.Errorf("expected an upgrade from another version not to match")
+	}
+	if err := s.Add([]Definition{{Job: "/ci-[/", Variants: "x", ExtendedVariants: "x"}}); err == nil {
+		t.Errorf("expected an invalid expression to be rejected")
+	}
+}
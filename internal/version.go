@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is an OCP release, e.g. 4.15.
+type Version struct {
+	Major int
+	Minor int
+}
+
+// LastMinor is the last minor release of each major version that had a
+// successor, so the release before X.0 is known.
+var LastMinor = map[int]int{
+	3: 11,
+}
+
+var versionRe = regexp.MustCompile(`^v?(\d+)\.(\d+)$`)
+
+// ParseVersion parses a version such as "4.15".
+func ParseVersion(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid OCP version %q, expected major.minor (example: 4.15)", s)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return Version{Major: major, Minor: minor}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Previous returns the release before v. It is unknown for the first minor of
+// a major version, unless the last minor of the previous one is in LastMinor.
+func (v Version) Previous() (Version, bool) {
+	if v.Minor > 0 {
+		return Version{Major: v.Major, Minor: v.Minor - 1}, true
+	}
+	if last, ok := LastMinor[v.Major-1]; ok {
+		return Version{Major: v.Major - 1, Minor: last}, true
+	}
+	return Version{}, false
+}
+
+// jobVersionRe matches whole versions in job names, so "4.1" is not taken
+// from "4.15" nor from "4.15.1".
+var jobVersionRe = regexp.MustCompile(`(?:^|[^\d.])(\d+\.\d+)(?:$|[^\d.]|\.\D)`)
+
+// JobVersion returns the version a job is for, which is the first one its
+// name mentions. Upgrade jobs mention more than one version, e.g.
+// ci-4.15-upgrade-from-stable-4.14, and are for the first one.
+func JobVersion(name string) (Version, bool) {
+	m := jobVersionRe.FindStringSubmatch(name)
+	if m == nil {
+		return Version{}, false
+	}
+	v, err := ParseVersion(m[1])
+	return v, err == nil
+}
+
+// releaseBranchRe matches the branches of OCP releases, e.g. release-4.15.
+var releaseBranchRe = regexp.MustCompile(`^(?:release|openshift)-(\d+\.\d+)$`)
+
+// VersionForBranch returns the OCP version a branch is for. Release branches
+// carry the version in their name; other branches, such as master or main,
+// are looked up in devBranches.
+func VersionForBranch(branch string, devBranches map[string]Version) (Version, bool) {
+	if m := releaseBranchRe.FindStringSubmatch(branch); m != nil {
+		if v, err := ParseVersion(m[1]); err == nil {
+			return v, true
+		}
+	}
+	v, ok := devBranches[branch]
+	return v, ok
+}
+
+// ParseBranchVersions parses a comma-separated list of branch=version pairs,
+// e.g. "master=4.16,main=4.16".
+func ParseBranchVersions(s string) (map[string]Version, error) {
+	versions := map[string]Version{}
+	if s == "" {
+		return versions, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		branch, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || branch == "" {
+			return nil, fmt.Errorf("invalid branch version %q, expected branch=version", pair)
+		}
+		v, err := ParseVersion(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version for branch %q: %w", branch, err)
+		}
+		versions[branch] = v
+	}
+	return versions, nil
+}
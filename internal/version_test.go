@@ -0,0 +1,76 @@
+package internal
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "4.15", want: Version{Major: 4, Minor: 15}},
+		{in: "v4.9", want: Version{Major: 4, Minor: 9}},
+		{in: " 4.16 ", want: Version{Major: 4, Minor: 16}},
+		{in: "4", wantErr: true},
+		{in: "4.15.1", wantErr: true},
+		{in: "latest", wantErr: true},
+	} {
+		got, err := ParseVersion(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseVersion(%q) returned error %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseVersion(%q) = %v, expected %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	for _, tc := range []struct {
+		in   Version
+		want string
+	}{
+		{Version{4, 15}, "4.14"},
+		{Version{4, 10}, "4.9"},
+		{Version{4, 0}, "3.11"},
+		{Version{5, 0}, ""},
+	} {
+		got, ok := tc.in.Previous()
+		if tc.want == "" {
+			if ok {
+				t.Errorf("%v.Previous() = %v, expected none", tc.in, got)
+			}
+			continue
+		}
+		if !ok || got.String() != tc.want {
+			t.Errorf("%v.Previous() = %v, %v, expected %s", tc.in, got, ok, tc.want)
+		}
+	}
+}
+
+func TestJobVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"periodic-ci-openshift-release-master-nightly-4.15-e2e-aws-ovn", "4.15"},
+		// Upgrade jobs are for the first version they mention.
+		{"periodic-ci-openshift-release-master-ci-4.15-upgrade-from-stable-4.14-e2e-aws-ovn-upgrade", "4.15"},
+		// Only whole versions count.
+		{"periodic-ci-openshift-release-master-nightly-4.1-e2e-aws", "4.1"},
+		{"release-openshift-origin-installer-e2e-aws-upgrade-4.14.1-to-4.15", "4.15"},
+		{"pull-ci-openshift-origin-master-unit", ""},
+	} {
+		got, ok := JobVersion(tc.name)
+		if tc.want == "" {
+			if ok {
+				t.Errorf("JobVersion(%q) = %v, expected none", tc.name, got)
+			}
+			continue
+		}
+		if !ok || got.String() != tc.want {
+			t.Errorf("JobVersion(%q) = %v, %v, expected %s", tc.name, got, ok, tc.want)
+		}
+	}
+}
@@ -3,26 +3,70 @@
 package main
 
 import (
+	"bufio"
+	_ "embed"
 	"flag"
 	"fmt"
 	"os"
-	"regexp"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/bertinatto/testgrid/internal"
 	"github.com/bertinatto/testgrid/internal/crawler"
 	"github.com/bertinatto/testgrid/internal/report"
+	"github.com/bertinatto/testgrid/internal/variants"
 )
 
+// defaultVariants are the variant definitions used unless overridden with -variants.
+//
+//go:embed variants/input.tsv
+var defaultVariants []byte
+
 func main() {
-	prFlag := flag.String("pr", "", "pull request in the format 'org/repo#prID'")
-	ocpVersionFlag := flag.String("ocp-version", "", "ocp version to match jobs against (example: 4.15)")
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		cacheCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "infer-variants" {
+		inferVariantsCommand(os.Args[2:])
+		return
+	}
+
+	prs := []internal.PullRequest{}
+	flag.Func("pr", "pull request as 'org/repo#N' or its URL; repeat the flag or separate with commas to crawl several PRs, e.g. backports", func(s string) error {
+		for _, ref := range strings.Split(s, ",") {
+			pr, err := internal.ParsePullRequest(ref)
+			if err != nil {
+				return err
+			}
+			prs = append(prs, pr)
+		}
+		return nil
+	})
+	ocpVersionFlag := flag.String("ocp-version", "", "comma-separated ocp versions to match jobs against, one matrix is rendered per version (example: 4.15 or 4.14,4.15,4.16; default: inferred from the base branch of each PR)")
+	branchVersionsFlag := flag.String("branch-versions", "", "comma-separated branch=version pairs telling the ocp version of PRs against development branches, when it is inferred (example: master=4.16,main=4.16)")
 	outputFlag := flag.String("output", "report.html", "specify the output file for the report (default: report.html)")
 	cacheDirFlag := flag.String("cache-dir", "", "specify the directory where scraped data should be cached (default: no cache)")
+	cacheTTLFlag := flag.String("cache-ttl", "", "comma-separated host=duration pairs overriding how long responses are cached (example: api.github.com=1m)")
+	githubTokenFlag := flag.String("github-token", "", "GitHub token used to access the API (default: $GITHUB_TOKEN)")
+	githubTokenFileFlag := flag.String("github-token-file", "", "file containing the GitHub token used to access the API")
+	parallelismFlag := flag.Int("parallelism", 4, "maximum number of concurrent requests made to each host")
+	delayFlag := flag.Duration("delay", 0, "time to wait after each request before making another one to the same host")
+	attemptsFlag := flag.Int("attempts", 3, fmt.Sprintf("number of times a request is tried before giving up on transient failures, between 1 and %d", crawler.MaxAttempts))
+	outdatedFlag := flag.String("outdated-runs", report.OutdatedExclude, "how to handle payload runs that tested an outdated commit of the PR: exclude, mark or include")
+	historyFlag := flag.Bool("history", false, "also render one matrix per PR commit, highlighting cells that changed between commits")
+	watchFlag := flag.Bool("watch", false, "keep crawling pending jobs and updating the report until they are done")
+	watchIntervalFlag := flag.Duration("watch-interval", 10*time.Minute, "time between crawls in watch mode")
+	watchDeadlineFlag := flag.Duration("watch-deadline", 6*time.Hour, "give up watching pending jobs after this long")
+	endpointsFlag := flag.String("endpoints", "", "JSON file describing where the CI services are, for Prow deployments other than OpenShift CI's")
+	rewriteFlag := flag.String("rewrite", "", "comma-separated from=to URL prefixes to fetch from somewhere else (example: https://api.github.com=http://localhost:8080)")
+	variantsFlag := flag.String("variants", "", "comma-separated TSV, YAML or JSON files with variant definitions, overriding the built-in ones in order")
+	fixturesDirFlag := flag.String("fixtures-dir", "", "read pages from fixtures recorded in this directory instead of live hosts")
 	flag.Parse()
 
-	if *ocpVersionFlag == "" {
+	if len(prs) == 0 {
 		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "ERROR: OCP version cannot be empty.\n")
+		fmt.Fprintf(os.Stderr, "ERROR: Pull request cannot be empty.\n")
 		os.Exit(1)
 	}
 
@@ -32,43 +76,359 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Extract organization, repository, and pull request ID
-	re := regexp.MustCompile(`^(\w+)/(\w+)#(\d+)$`)
-	matches := re.FindStringSubmatch(*prFlag)
-	if len(matches) < 3 {
-		fmt.Fprintf(os.Stderr, "ERROR: Invalid input format %q. Expected: 'org/repo#pr\n", *prFlag)
-		flag.PrintDefaults()
+	if *attemptsFlag < 1 || *attemptsFlag > crawler.MaxAttempts {
+		fmt.Fprintf(os.Stderr, "ERROR: -attempts must be between 1 and %d.\n", crawler.MaxAttempts)
 		os.Exit(1)
 	}
 
-	org := matches[1]
-	repo := matches[2]
-	prID, err := strconv.Atoi(matches[3])
+	cacheTTLs, err := crawler.ParseCacheTTLs(*cacheTTLFlag)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: Failed to convert pull request ID to integer: %v", err)
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Extract current and previous OCP versions
-	v, err := strconv.ParseFloat(*ocpVersionFlag, 32)
+	endpoints := crawler.DefaultEndpoints
+	if *endpointsFlag != "" {
+		endpoints, err = crawler.LoadEndpoints(*endpointsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Cannot read endpoints: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	rewrites, err := crawler.ParseRewrites(*rewriteFlag)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: Cannot parse OCP version: %s\n", *ocpVersionFlag)
-		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	endpoints = endpoints.WithRewrites(rewrites)
+
+	githubToken, err := readGitHubToken(*githubTokenFlag, *githubTokenFileFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Cannot read GitHub token: %v\n", err)
+		os.Exit(1)
+	}
+	if githubToken == "" {
+		fmt.Fprintf(os.Stderr, "WARNING: No GitHub token provided, API access is limited to 60 requests per hour.\n")
+	}
+
+	// Extract the OCP versions, unless they are to be inferred
+	versions := []internal.Version{}
+	if *ocpVersionFlag != "" {
+		for _, s := range strings.Split(*ocpVersionFlag, ",") {
+			v, err := internal.ParseVersion(s)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: Cannot parse OCP version: %v\n", err)
+				flag.PrintDefaults()
+				os.Exit(1)
+			}
+			versions = append(versions, v)
+		}
+	}
+	branchVersions, err := internal.ParseBranchVersions(*branchVersionsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
 		os.Exit(1)
 	}
-	curVer := fmt.Sprintf("%.2f", v)
-	prevVer := fmt.Sprintf("%.2f", v-0.01)
 
-	jobs := crawler.New(org, repo, prID, curVer, *cacheDirFlag).Do()
-	report := report.New(curVer, prevVer, org, repo, prID)
-	err = report.Create(jobs)
+	knownVariants, err := loadVariants(*variantsFlag)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: Failed to create report: %v", err)
+		fmt.Fprintf(os.Stderr, "ERROR: Cannot load variants: %v\n", err)
 		os.Exit(1)
 	}
 
-	if err := report.WriteToFile(*outputFlag); err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: Failed to write report to file: %v", err)
+	// newReport creates an empty report with the settings given in the
+	// command line, for the versions crawled so far.
+	newReport := func(crawlers []*crawler.Crawler) (*report.Report, error) {
+		r := report.New(prs[0])
+		for _, pr := range prs[1:] {
+			r.AddPullRequest(pr)
+		}
+		for _, c := range crawlers {
+			for _, v := range c.Versions() {
+				r.AddVersion(v)
+			}
+		}
+		if err := r.SetOutdatedRuns(*outdatedFlag); err != nil {
+			return nil, err
+		}
+		r.SetHistory(*historyFlag)
+		r.SetVariants(knownVariants)
+		return r, nil
+	}
+	if _, err := newReport(nil); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	var fetcher crawler.Fetcher
+	if *fixturesDirFlag != "" {
+		fetcher = crawler.NewFileFetcher(*fixturesDirFlag)
+	}
+
+	crawlers := []*crawler.Crawler{}
+	jobs := map[string][]*internal.ProwJob{}
+	for _, pr := range prs {
+		c := crawler.New(pr, versions, crawler.Options{
+			CacheDir:       *cacheDirFlag,
+			CacheTTLs:      cacheTTLs,
+			GitHubToken:    githubToken,
+			Fetcher:        fetcher,
+			Endpoints:      &endpoints,
+			Parallelism:    *parallelismFlag,
+			Delay:          *delayFlag,
+			Attempts:       *attemptsFlag,
+			BranchVersions: branchVersions,
+		})
+		found, err := c.Do()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Failed to crawl %s: %v\n", pr, err)
+			os.Exit(1)
+		}
+		crawlers = append(crawlers, c)
+		mergeJobs(jobs, found)
+	}
+	r, err := newReport(crawlers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if err := writeReport(r, crawlers, jobs, *outputFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if !*watchFlag {
+		return
+	}
+
+	// Keep crawling the pending jobs until they are all done.
+	deadline := time.Now().Add(*watchDeadlineFlag)
+	for pending(crawlers) > 0 {
+		if time.Now().Add(*watchIntervalFlag).After(deadline) {
+			fmt.Fprintf(os.Stderr, "Deadline reached, %d jobs are still pending.\n", pending(crawlers))
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "%d jobs are pending, checking again in %s.\n", pending(crawlers), *watchIntervalFlag)
+		time.Sleep(*watchIntervalFlag)
+
+		jobs := map[string][]*internal.ProwJob{}
+		for _, c := range crawlers {
+			mergeJobs(jobs, c.Refresh())
+		}
+		next, err := newReport(crawlers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeReport(next, crawlers, jobs, *outputFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		for _, change := range report.Changes(r, next) {
+			fmt.Println(change)
+		}
+		r = next
+	}
+	fmt.Fprintf(os.Stderr, "No jobs are pending anymore.\n")
+}
+
+// mergeJobs adds the jobs found by a crawler to jobs.
+func mergeJobs(jobs, found map[string][]*internal.ProwJob) {
+	for name, runs := range found {
+		jobs[name] = append(jobs[name], runs...)
+	}
+}
+
+// pending returns the number of jobs that haven't finished yet.
+func pending(crawlers []*crawler.Crawler) int {
+	n := 0
+	for _, c := range crawlers {
+		n += c.Pending()
+	}
+	return n
+}
+
+// writeReport fills the report with the crawled jobs and writes it to the output file.
+func writeReport(r *report.Report, crawlers []*crawler.Crawler, jobs map[string][]*internal.ProwJob, output string) error {
+	problems := []internal.CrawlProblem{}
+	for _, c := range crawlers {
+		problems = append(problems, c.Problems()...)
+		r.SetHeadCommit(c.PullRequest(), c.HeadSHA())
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: Found %d problems while crawling, see the report for details.\n", len(problems))
+	}
+
+	r.AddProblems(problems)
+	if err := r.Create(jobs); err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+
+	if err := r.WriteToFile(output); err != nil {
+		return fmt.Errorf("failed to write report to file: %w", err)
+	}
+	return nil
+}
+
+// loadVariants reads the built-in variant definitions, then the ones in the
+// given comma-separated files, which take precedence.
+func loadVariants(files string) (*variants.Set, error) {
+	set := &variants.Set{}
+	defs, err := variants.Parse(".tsv", defaultVariants)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing built-in variants: %w", err)
+	}
+	if err := set.Add(defs); err != nil {
+		return nil, err
+	}
+	if files == "" {
+		return set, nil
+	}
+	for _, file := range strings.Split(files, ",") {
+		defs, err := variants.LoadFile(strings.TrimSpace(file))
+		if err != nil {
+			return nil, err
+		}
+		if err := set.Add(defs); err != nil {
+			return nil, fmt.Errorf("error loading %q: %w", file, err)
+		}
+	}
+	return set, nil
+}
+
+// readGitHubToken returns the GitHub token from the flag, the token file or the
+// GITHUB_TOKEN environment variable, in that order of precedence.
+func readGitHubToken(token, file string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return os.Getenv("GITHUB_TOKEN"), nil
+}
+
+// cacheCommand handles "testgrid cache prune|clear", which remove expired or
+// all entries from the cache directory. Pruning also removes the GitHub pages
+// that haven't been fetched in full for a week.
+func cacheCommand(args []string) {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	cacheDirFlag := fs.String("cache-dir", "", "directory where scraped data is cached")
+	cacheTTLFlag := fs.String("cache-ttl", "", "comma-separated host=duration pairs overriding how long responses are cached")
+	endpointsFlag := fs.String("endpoints", "", "JSON file describing where the CI services are, so their pages expire like when crawling")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: testgrid cache prune|clear -cache-dir DIR\n")
+		fmt.Fprintf(os.Stderr, "prune removes expired entries and GitHub pages not fetched in full for a week; clear removes everything.\n")
+		fs.PrintDefaults()
+	}
+	if len(args) < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	if *cacheDirFlag == "" {
+		fs.Usage()
+		fmt.Fprintf(os.Stderr, "ERROR: Cache directory cannot be empty.\n")
+		os.Exit(1)
+	}
+	ttls, err := crawler.ParseCacheTTLs(*cacheTTLFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	endpoints := crawler.DefaultEndpoints
+	if *endpointsFlag != "" {
+		endpoints, err = crawler.LoadEndpoints(*endpointsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Cannot read endpoints: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cache := crawler.NewCache(*cacheDirFlag, endpoints, ttls)
+
+	switch action {
+	case "prune":
+		removed, err := cache.Prune()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Failed to prune cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %d expired entries from %s\n", removed, *cacheDirFlag)
+	case "clear":
+		if err := cache.Clear(); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Failed to clear cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Cleared %s\n", *cacheDirFlag)
+	default:
+		fs.Usage()
+		fmt.Fprintf(os.Stderr, "ERROR: Unknown cache action %q.\n", action)
+		os.Exit(1)
+	}
+}
+
+// inferVariantsCommand handles "testgrid infer-variants", which prints TSV
+// lines with the variants inferred for the given jobs, so they can be reviewed
+// and added to variants/input.tsv. Job names are read from standard input if
+// none are given. Jobs with a known variant are skipped.
+func inferVariantsCommand(args []string) {
+	fs := flag.NewFlagSet("infer-variants", flag.ExitOnError)
+	variantsFlag := fs.String("variants", "", "comma-separated TSV, YAML or JSON files with variant definitions, overriding the built-in ones in order")
+	ocpVersionFlag := fs.String("ocp-version", "", "ocp version of the jobs, for matching them against job name templates")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: testgrid infer-variants [JOB...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var version internal.Version
+	if *ocpVersionFlag != "" {
+		var err error
+		version, err = internal.ParseVersion(*ocpVersionFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Cannot parse OCP version: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	known, err := loadVariants(*variantsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Cannot load variants: %v\n", err)
+		os.Exit(1)
+	}
+
+	jobs := fs.Args()
+	if len(jobs) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if job := strings.TrimSpace(scanner.Text()); job != "" {
+				jobs = append(jobs, job)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Cannot read job names: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	defs := []variants.Definition{}
+	for _, job := range jobs {
+		if _, ok := known.Lookup(job, version); ok {
+			continue
+		}
+		def, ok := variants.Infer(job)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "WARNING: Cannot infer the variant of job %q.\n", job)
+			continue
+		}
+		defs = append(defs, def)
+	}
+	if err := variants.WriteTSV(os.Stdout, defs); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
 		os.Exit(1)
 	}
 }
@@ -1,18 +1,22 @@
 package main
 
 import (
-	"encoding/csv"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"sort"
-	"strings"
 
 	"github.com/bertinatto/testgrid/internal"
+	"github.com/bertinatto/testgrid/internal/variants"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		lint(os.Args[2:])
+		return
+	}
+
 	input := flag.String("input", "", "input TSV file")
 	output := flag.String("output", "", "output file")
 	flag.Parse()
@@ -44,64 +48,51 @@ func main() {
 	fmt.Printf("Go file generated: %s\n", *output)
 }
 
-func readTSVFile(filename string) (map[string]internal.Variant, error) {
-	file, err := os.Open(filename)
+// lint checks the input TSV file and prints the problems found, with their
+// line numbers. It exits with a non-zero status if there are any.
+func lint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	input := fs.String("input", "variants/input.tsv", "input TSV file")
+	fs.Parse(args)
+
+	file, err := os.Open(*input)
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Failed to open TSV file %s: %v\n", *input, err)
+		os.Exit(1)
 	}
 	defer file.Close()
 
-	data := make(map[string]internal.Variant, 128)
-	reader := csv.NewReader(file)
-	reader.Comma = '\t'
-
-	records, err := reader.ReadAll()
+	problems, err := variants.Lint(file)
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Failed to read TSV file %s: %v\n", *input, err)
+		os.Exit(1)
 	}
-
-	if len(records) < 1 {
-		return nil, fmt.Errorf("invalid TSV file: not enough records")
+	for _, p := range problems {
+		fmt.Printf("%s:%d: %s\n", *input, p.Line, p.Message)
 	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "Found %d problems in %s\n", len(problems), *input)
+		os.Exit(1)
+	}
+}
 
-	// Start from index 1 to discard headers
-	for i := 1; i < len(records); i++ {
-		line := records[i]
-		job := line[0]
-		variants := line[1]
-		extendedVariants := line[2]
-
-		extVarSplit := strings.Split(extendedVariants, ",")
-
-		upgradeFromCurrent := contains(extVarSplit, "upgrade-micro")
-		upgradeFromPrevious := contains(extVarSplit, "upgrade-minor")
-
-		if upgradeFromCurrent && upgradeFromPrevious {
-			return nil, fmt.Errorf("line %d contains both upgrade-micro and upgrade-minor", i)
-		}
-
-		v := internal.Variant{
-			Name:                variants,
-			Parallel:            contains(extVarSplit, "parallel"),
-			CSI:                 contains(extVarSplit, "csi"),
-			UpgradeFromCurrent:  upgradeFromCurrent,
-			UpgradeFromPrevious: upgradeFromPrevious,
-			Serial:              contains(extVarSplit, "serial"),
-		}
-
-		data[job] = v
+func readTSVFile(filename string) (map[string]internal.Variant, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	return data, nil
-}
+	defs, err := variants.ParseTSV(file)
+	if err != nil {
+		return nil, err
+	}
 
-func contains(slice []string, target string) bool {
-	for _, s := range slice {
-		if s == target {
-			return true
-		}
+	data := &variants.Set{}
+	if err := data.Add(defs); err != nil {
+		return nil, err
 	}
-	return false
+	return data.Jobs(), nil
 }
 
 func generateGoFile(filename string, data map[string]internal.Variant) error {